@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/JulianEZT/serverless-user-service/internal/worker"
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+func main() {
+	// Processed event ids are recorded in DEDUPE_TABLE, or in the users table when it is not set
+	tableName := os.Getenv("DEDUPE_TABLE")
+	if tableName == "" {
+		tableName = os.Getenv("USERS_TABLE")
+	}
+	if tableName == "" {
+		slog.Error("missing required env: DEDUPE_TABLE or USERS_TABLE must be set")
+		os.Exit(1)
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		slog.Error("failed to load AWS config", "error", err)
+		os.Exit(1)
+	}
+
+	d := worker.NewDispatcher()
+	d.Use(worker.Dedupe(worker.NewDynamoDedupeStore(dynamodb.NewFromConfig(cfg), tableName)))
+	d.Register(events.UserCreatedEventType, worker.HandleUserCreated)
+	d.Register(events.UserUpdatedEventType, worker.HandleUserUpdated)
+	d.Register(events.UserDeletedEventType, worker.HandleUserDeleted)
+	d.Register(events.UserRestoredEventType, worker.HandleUserRestored)
+
+	lambda.Start(d.HandleSQSEvent)
+}
@@ -0,0 +1,50 @@
+// Command eventschema writes the JSON Schemas of the events in pkg/events, the contract for consumers
+// in other languages. Before writing it checks that every schema already in the directory changes
+// only in backward-compatible ways; with -check it only verifies, for CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/JulianEZT/serverless-user-service/internal/eventschema"
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+func main() {
+	dir := flag.String("dir", "pkg/events/schemas", "directory holding the schema files")
+	check := flag.Bool("check", false, "do not write; fail if a schema is incompatible or out of date")
+	flag.Parse()
+
+	if err := run(*dir, *check); err != nil {
+		slog.Error("eventschema failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string, check bool) error {
+	files, err := eventschema.Generate(events.DefaultRegistry)
+	if err != nil {
+		return err
+	}
+	if err := eventschema.CheckDir(dir, files); err != nil {
+		return fmt.Errorf("%w\nadd a new event version instead of changing an existing one", err)
+	}
+	if check {
+		stale, err := eventschema.Stale(dir, files)
+		if err != nil {
+			return err
+		}
+		if len(stale) > 0 {
+			return fmt.Errorf("schemas out of date, run go run ./cmd/eventschema: %v", stale)
+		}
+		return nil
+	}
+	if err := eventschema.Write(dir, files); err != nil {
+		return err
+	}
+	slog.Info("wrote event schemas", "dir", dir, "count", len(files))
+	return nil
+}
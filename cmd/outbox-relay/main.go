@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/JulianEZT/serverless-user-service/internal/users"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// sweepBatchSize is the number of pending outbox messages delivered per invocation.
+const sweepBatchSize = 100
+
+var relay *users.OutboxRelay
+
+func init() {
+	tableName := os.Getenv("USERS_TABLE")
+	if tableName == "" {
+		slog.Error("missing required env: USERS_TABLE must be set")
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		slog.Error("failed to load AWS config", "error", err)
+		os.Exit(1)
+	}
+
+	// The relay never lists users, so no cursor key is needed.
+	repo := users.NewDynamoRepo(dynamodb.NewFromConfig(cfg), tableName, nil)
+	// Deliver to the same backend as the user API (EVENTS_BACKEND and its target)
+	publisher, err := users.NewEventPublisher(cfg, users.PublisherConfigFromEnv(os.Getenv))
+	if err != nil {
+		slog.Error("failed to configure event publisher", "error", err)
+		os.Exit(1)
+	}
+	relay = users.NewOutboxRelay(repo, publisher)
+}
+
+// handler runs on a schedule (e.g. an EventBridge rate rule) and delivers pending outbox messages.
+// Returning an error marks the invocation failed so it shows up in metrics; undelivered messages
+// stay pending and are retried on the next run.
+func handler(ctx context.Context) error {
+	_, err := relay.Sweep(ctx, sweepBatchSize)
+	return err
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,49 @@
+// Command user-api-local serves the user API over plain HTTP with in-memory storage and a fake JWT
+// authorizer, so it can be exercised with curl without deploying to AWS.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/JulianEZT/serverless-user-service/internal/users"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	claimsJSON := flag.String("claims", `{"sub":"local-user","scope":"users:read users:write","cognito:groups":"[admin]"}`, "JWT claims injected into every request, as a JSON object; override per request with the "+httpapi.ClaimsHeader+" header")
+	tenantClaim := flag.String("tenant-claim", "", "JWT claim holding the tenant id (e.g. custom:tenant_id); empty runs single-tenant")
+	timeout := flag.Duration("timeout", 29*time.Second, "per-request deadline, like the Lambda/API Gateway timeout")
+	flag.Parse()
+
+	var claims map[string]string
+	if err := json.Unmarshal([]byte(*claimsJSON), &claims); err != nil {
+		slog.Error("invalid -claims", "error", err)
+		os.Exit(1)
+	}
+
+	svc := users.NewService(users.NewMockRepo(), users.NewMockPublisher())
+	h := users.NewHandler(svc, users.NewMockIdempotencyStore())
+	api := httpapi.NewHTTPHandler(users.NewRouter(h, *tenantClaim), httpapi.StaticClaims(claims))
+
+	srv := &http.Server{
+		Addr: *addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), *timeout)
+			defer cancel()
+			api.ServeHTTP(w, r.WithContext(ctx))
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	slog.Info("user-api-local listening", "addr", *addr, "claims", claims)
+	if err := srv.ListenAndServe(); err != nil {
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
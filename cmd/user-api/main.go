@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 
@@ -11,54 +13,50 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
+// router is set by main before the Lambda runtime starts delivering events.
 var router *httpapi.Router
 
-func init() {
+// newRouter builds the user API from the environment described in README.md. It is separate from
+// main so tests can run handler against a router backed by in-memory stores instead.
+func newRouter(ctx context.Context) (*httpapi.Router, error) {
 	tableName := os.Getenv("USERS_TABLE")
-	queueURL := os.Getenv("EVENTS_QUEUE_URL")
-	if tableName == "" || queueURL == "" {
-		slog.Error("missing required env: USERS_TABLE and EVENTS_QUEUE_URL must be set")
-		os.Exit(1)
+	cursorKey := os.Getenv("CURSOR_SIGNING_KEY")
+	if tableName == "" || cursorKey == "" {
+		return nil, errors.New("missing required env: USERS_TABLE and CURSOR_SIGNING_KEY must be set (see cmd/user-api/README.md)")
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.Background())
+	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		slog.Error("failed to load AWS config", "error", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("load AWS config: %w", err)
 	}
 
-	ddb := dynamodb.NewFromConfig(cfg)
-	sqsClient := sqs.NewFromConfig(cfg)
+	// EVENTS_BACKEND picks SQS (default), EventBridge or SNS; see users.PublisherConfigFromEnv
+	publisher, err := users.NewEventPublisher(cfg, users.PublisherConfigFromEnv(os.Getenv))
+	if err != nil {
+		return nil, fmt.Errorf("event publisher: %w", err)
+	}
 
-	repo := users.NewDynamoRepo(ddb, tableName)
-	publisher := users.NewSQSPublisher(sqsClient, queueURL)
+	ddb := dynamodb.NewFromConfig(cfg)
+	repo := users.NewDynamoRepo(ddb, tableName, []byte(cursorKey))
 	svc := users.NewService(repo, publisher)
-	h := users.NewHandler(svc)
+	idem := users.NewDynamoIdempotencyStore(ddb, tableName)
+	h := users.NewHandler(svc, idem)
 
-	router = httpapi.NewRouter()
-	router.Register("POST", "/users", h.CreateUser)
-	router.Register("GET", "/users/{id}", h.GetUser)
+	return users.NewRouter(h, os.Getenv("TENANT_CLAIM")), nil
 }
 
 func handler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	method := req.RequestContext.HTTP.Method
-	path := req.RawPath
-	if path == "" && req.RequestContext.HTTP.Path != "" {
-		path = req.RequestContext.HTTP.Path
-	}
-	if path == "" {
-		path = "/"
-	}
-	h := router.Route(method, path)
-	if h == nil {
-		return httpapi.ErrorResponse(404, "not found"), nil
-	}
-	return h(req)
+	return router.Handle(ctx, req)
 }
 
 func main() {
+	r, err := newRouter(context.Background())
+	if err != nil {
+		slog.Error("failed to start user API", "error", err)
+		os.Exit(1)
+	}
+	router = r
 	lambda.Start(handler)
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/users"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden response files in testdata")
+
+// goldenResponse is the stored form of a response; JSON bodies are kept as indented JSON so diffs are readable.
+type goldenResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       json.RawMessage   `json:"body,omitempty"`
+}
+
+// seededRouter points router at in-memory stores holding fixed users, so responses are reproducible.
+func seededRouter(t *testing.T) {
+	t.Helper()
+	repo := users.NewMockRepo()
+	for _, u := range []users.User{
+		{ID: "u1", Email: "alice@example.com", Name: "Alice", Subject: "u1", CreatedAt: "2026-01-01T00:00:00Z", CreatedBy: "admin-1"},
+		{ID: "jane@example.com", Email: "jane@example.com", Name: "Jane", CreatedAt: "2026-01-02T00:00:00Z", CreatedBy: "admin-1"},
+		{ID: "u3", Email: "carol@example.com", Name: "Carol", CreatedAt: "2026-01-03T00:00:00Z", CreatedBy: "admin-1"},
+	} {
+		if err := repo.Put(context.Background(), &u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := users.NewService(repo, users.NewMockPublisher())
+	router = users.NewRouter(users.NewHandler(svc, users.NewMockIdempotencyStore()), "")
+}
+
+// TestHandler_Golden replays the API Gateway v2 events in testdata/*.request.json through handler and
+// compares each response with the matching .response.json. Run with -update after an intended change.
+func TestHandler_Golden(t *testing.T) {
+	requests, err := filepath.Glob("testdata/*.request.json")
+	if err != nil || len(requests) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range requests {
+		name := strings.TrimSuffix(filepath.Base(path), ".request.json")
+		t.Run(name, func(t *testing.T) {
+			seededRouter(t)
+			raw, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var req events.APIGatewayV2HTTPRequest
+			if err := json.Unmarshal(raw, &req); err != nil {
+				t.Fatalf("decode %s: %v", path, err)
+			}
+			resp, err := handler(context.Background(), req)
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			got := encodeGolden(t, resp)
+
+			goldenPath := filepath.Join("testdata", name+".response.json")
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("response differs from %s:\ngot:\n%s\nwant:\n%s", goldenPath, got, want)
+			}
+		})
+	}
+}
+
+func encodeGolden(t *testing.T, resp events.APIGatewayV2HTTPResponse) []byte {
+	t.Helper()
+	g := goldenResponse{StatusCode: resp.StatusCode, Headers: resp.Headers}
+	if resp.Body != "" {
+		if !json.Valid([]byte(resp.Body)) {
+			t.Fatalf("body is not JSON: %q", resp.Body)
+		}
+		g.Body = json.RawMessage(resp.Body)
+	}
+	out, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(out, '\n')
+}
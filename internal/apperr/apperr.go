@@ -0,0 +1,131 @@
+// Package apperr defines the typed errors shared by the domain and transport layers. Each error has
+// a Kind, which decides the HTTP status, and a stable machine-readable Code that clients can match on.
+package apperr
+
+import (
+	"errors"
+	"strings"
+)
+
+// Kind classifies an Error.
+type Kind string
+
+const (
+	KindValidation           Kind = "validation"            // the request is malformed or breaks an input rule (400)
+	KindUnauthorized         Kind = "unauthorized"          // the caller is not authenticated (401)
+	KindForbidden            Kind = "forbidden"             // the caller may not perform the operation (403)
+	KindNotFound             Kind = "not found"             // the resource does not exist (404)
+	KindConflict             Kind = "conflict"              // the request conflicts with the current state (409)
+	KindPrecondition         Kind = "precondition"          // a conditional request header did not match the resource (412)
+	KindUnprocessable        Kind = "unprocessable"         // the request is well-formed but cannot be processed (422)
+	KindPreconditionRequired Kind = "precondition required" // a mutating request lacks a conditional header (428)
+	KindUnavailable          Kind = "unavailable"           // a dependency or the time budget failed; retrying may help (503)
+)
+
+// CodeValidationFailed is the Code of errors built by Invalid.
+const CodeValidationFailed = "validation_failed"
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"` // e.g. "required", "invalid_format"
+	Message string `json:"message"`
+}
+
+// Error is a typed application error. Errors with the same Kind and Code match with errors.Is,
+// so a sentinel keeps matching after Wrap.
+type Error struct {
+	Kind   Kind
+	Code   string       // stable, machine-readable, e.g. "user_not_found"
+	Detail string       // human-readable explanation, safe to return to clients
+	Fields []FieldError // per-field problems, for KindValidation
+	Err    error        // underlying cause, never returned to clients
+}
+
+func (e *Error) Error() string {
+	return string(e.Kind) + ": " + e.Detail
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same Kind and Code.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// Wrap returns a copy of e with cause attached.
+func (e *Error) Wrap(cause error) *Error {
+	cp := *e
+	cp.Err = cause
+	return &cp
+}
+
+// New returns an Error of the given kind.
+func New(kind Kind, code, detail string) *Error {
+	return &Error{Kind: kind, Code: code, Detail: detail}
+}
+
+// Validation returns a KindValidation error, optionally listing the offending fields.
+func Validation(code, detail string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: code, Detail: detail, Fields: fields}
+}
+
+// Invalid returns a CodeValidationFailed error for fields, with the field messages joined as the detail.
+// It returns nil if fields is empty.
+func Invalid(fields ...FieldError) *Error {
+	if len(fields) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	return Validation(CodeValidationFailed, strings.Join(msgs, "; "), fields...)
+}
+
+// NotFound returns a KindNotFound error.
+func NotFound(code, detail string) *Error { return New(KindNotFound, code, detail) }
+
+// Conflict returns a KindConflict error.
+func Conflict(code, detail string) *Error { return New(KindConflict, code, detail) }
+
+// Unauthorized returns a KindUnauthorized error.
+func Unauthorized(code, detail string) *Error { return New(KindUnauthorized, code, detail) }
+
+// Forbidden returns a KindForbidden error.
+func Forbidden(code, detail string) *Error { return New(KindForbidden, code, detail) }
+
+// PreconditionFailed returns a KindPrecondition error.
+func PreconditionFailed(code, detail string) *Error { return New(KindPrecondition, code, detail) }
+
+// PreconditionRequired returns a KindPreconditionRequired error.
+func PreconditionRequired(code, detail string) *Error {
+	return New(KindPreconditionRequired, code, detail)
+}
+
+// Unprocessable returns a KindUnprocessable error.
+func Unprocessable(code, detail string) *Error { return New(KindUnprocessable, code, detail) }
+
+// Unavailable returns a KindUnavailable error.
+func Unavailable(code, detail string) *Error { return New(KindUnavailable, code, detail) }
+
+// As returns the first *Error in err's chain.
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// KindOf returns the Kind of the first *Error in err's chain, or "" for untyped errors.
+func KindOf(err error) Kind {
+	if e, ok := As(err); ok {
+		return e.Kind
+	}
+	return ""
+}
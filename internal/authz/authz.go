@@ -0,0 +1,126 @@
+// Package authz decides from JWT claims whether a caller may perform a request. Rules are attached
+// to routes with Require and deny with 403 and the unmet requirement as the reason.
+package authz
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Claims read into a Principal. API Gateway passes list claims as strings, either space-separated
+// ("users:read users:write") or in brackets ("[admin support]").
+const (
+	ScopeClaim  = "scope"
+	GroupsClaim = "cognito:groups"
+)
+
+// roleClaims are the custom claims that may carry roles, merged in this order.
+var roleClaims = []string{"roles", "custom:roles", "custom:role"}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Groups  []string
+	Roles   []string
+}
+
+// FromRequest builds the Principal from the JWT authorizer claims of req.
+func FromRequest(req *httpapi.Request) Principal {
+	p := Principal{
+		Subject: req.Claim("sub"),
+		Scopes:  splitClaim(req.Claim(ScopeClaim)),
+		Groups:  splitClaim(req.Claim(GroupsClaim)),
+	}
+	for _, c := range roleClaims {
+		p.Roles = append(p.Roles, splitClaim(req.Claim(c))...)
+	}
+	return p
+}
+
+func splitClaim(v string) []string {
+	v = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(v), "["), "]")
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ' ' || r == ',' })
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule is a requirement on the caller of a request.
+type Rule struct {
+	desc  string // e.g. "scope users:read"
+	allow func(p Principal, req *httpapi.Request) bool
+}
+
+// String describes the requirement, as used in the 403 reason.
+func (r Rule) String() string {
+	return r.desc
+}
+
+// Allows reports whether p may perform req.
+func (r Rule) Allows(p Principal, req *httpapi.Request) bool {
+	return r.allow(p, req)
+}
+
+// Scope requires the OAuth scope s.
+func Scope(s string) Rule {
+	return Rule{desc: "scope " + s, allow: func(p Principal, _ *httpapi.Request) bool { return contains(p.Scopes, s) }}
+}
+
+// Group requires membership of the Cognito group g.
+func Group(g string) Rule {
+	return Rule{desc: "group " + g, allow: func(p Principal, _ *httpapi.Request) bool { return contains(p.Groups, g) }}
+}
+
+// Role requires the custom role r.
+func Role(r string) Rule {
+	return Rule{desc: "role " + r, allow: func(p Principal, _ *httpapi.Request) bool { return contains(p.Roles, r) }}
+}
+
+// Self requires the path parameter param (e.g. "id") to equal the caller's sub.
+func Self(param string) Rule {
+	return Rule{desc: "the caller's own user", allow: func(p Principal, req *httpapi.Request) bool {
+		return p.Subject != "" && req.PathParam(param) == p.Subject
+	}}
+}
+
+// AnyOf passes if any of rules passes.
+func AnyOf(rules ...Rule) Rule {
+	descs := make([]string, len(rules))
+	for i, r := range rules {
+		descs[i] = r.desc
+	}
+	return Rule{desc: strings.Join(descs, " or "), allow: func(p Principal, req *httpapi.Request) bool {
+		for _, r := range rules {
+			if r.allow(p, req) {
+				return true
+			}
+		}
+		return false
+	}}
+}
+
+// Require returns a route middleware that rejects callers not satisfying rule with 403 forbidden.
+// Authentication (a sub claim) is checked separately by httpapi.RequireClaim.
+func Require(rule Rule) httpapi.Middleware {
+	return func(next httpapi.Handler) httpapi.Handler {
+		return func(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+			if p := FromRequest(req); !rule.Allows(p, req) {
+				slog.Warn("access denied", "requestId", req.RequestContext.RequestID, "requesterSub", p.Subject, "requires", rule.desc)
+				return httpapi.Problem(apperr.Forbidden("forbidden", "requires "+rule.desc), req.RequestContext.RequestID), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func request(method, path string, claims map[string]string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		RawPath: path,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "req-1",
+			HTTP:      events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: method, Path: path},
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: claims},
+			},
+		},
+	}
+}
+
+func ok(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	return events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil
+}
+
+func TestRequire(t *testing.T) {
+	admin := AnyOf(Group("admin"), Role("admin"))
+	r := httpapi.NewRouter()
+	r.Register("GET", "/users/{id}", ok, Require(AnyOf(Scope("users:read"), admin, Self("id"))))
+	r.Register("DELETE", "/users/{id}", ok, Require(admin))
+
+	tests := []struct {
+		name         string
+		method, path string
+		claims       map[string]string
+		status       int
+	}{
+		{"read scope", "GET", "/users/u2", map[string]string{"sub": "u1", "scope": "openid users:read"}, 200},
+		{"self", "GET", "/users/u1", map[string]string{"sub": "u1"}, 200},
+		{"other user", "GET", "/users/u2", map[string]string{"sub": "u1", "scope": "users:write"}, 403},
+		{"admin group", "GET", "/users/u2", map[string]string{"sub": "u1", "cognito:groups": "[support admin]"}, 200},
+		{"custom role", "DELETE", "/users/u2", map[string]string{"sub": "u1", "custom:roles": "admin"}, 200},
+		{"self is not admin", "DELETE", "/users/u1", map[string]string{"sub": "u1", "scope": "users:read"}, 403},
+	}
+	for _, tt := range tests {
+		resp, err := r.Handle(context.Background(), request(tt.method, tt.path, tt.claims))
+		if err != nil || resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, err %v, want %d", tt.name, resp.StatusCode, err, tt.status)
+		}
+	}
+
+	resp, _ := r.Handle(context.Background(), request("GET", "/users/u2", map[string]string{"sub": "u1"}))
+	var p httpapi.ProblemDetails
+	if err := json.Unmarshal([]byte(resp.Body), &p); err != nil {
+		t.Fatalf("decode %s: %v", resp.Body, err)
+	}
+	if p.Code != "forbidden" || p.Detail != "requires scope users:read or group admin or role admin or the caller's own user" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
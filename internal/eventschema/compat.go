@@ -0,0 +1,111 @@
+package eventschema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrIncompatible is returned by CheckCompatible when a schema change breaks consumers of the version.
+var ErrIncompatible = errors.New("backward-incompatible schema change")
+
+// CheckCompatible returns an error wrapping ErrIncompatible, listing every breaking change, unless
+// documents valid under next are still valid under prev and vice versa. That allows adding optional
+// fields and nothing else: consumers built against prev keep reading new events, and events already
+// published under prev still validate against next. Breaking changes need a new version.
+func CheckCompatible(prev, next *Schema) error {
+	var changes []string
+	compare(prev, next, "", &changes)
+	if len(changes) > 0 {
+		return fmt.Errorf("%w: %s", ErrIncompatible, strings.Join(changes, "; "))
+	}
+	return nil
+}
+
+func compare(prev, next *Schema, path string, changes *[]string) {
+	at := path
+	if at == "" {
+		at = "/"
+	}
+	report := func(format string, args ...interface{}) {
+		*changes = append(*changes, at+": "+fmt.Sprintf(format, args...))
+	}
+	if next == nil {
+		report("removed")
+		return
+	}
+	if !sameTypes(prev.Type, next.Type) {
+		report("type changed from %s to %s", typeString(prev.Type), typeString(next.Type))
+		return
+	}
+	if prev.Format != next.Format {
+		report("format changed from %q to %q", prev.Format, next.Format)
+	}
+	if (prev.Const == nil) != (next.Const == nil) || (prev.Const != nil && *prev.Const != *next.Const) {
+		report("const changed from %s to %s", constString(prev.Const), constString(next.Const))
+	}
+
+	prevRequired, nextRequired := set(prev.Required), set(next.Required)
+	for _, name := range sortedKeys(prev.Properties) {
+		compare(prev.Properties[name], next.Properties[name], path+"/"+name, changes)
+		if prevRequired[name] && !nextRequired[name] {
+			*changes = append(*changes, path+"/"+name+": no longer required")
+		}
+	}
+	for _, name := range next.Required {
+		if !prevRequired[name] {
+			*changes = append(*changes, path+"/"+name+": newly required")
+		}
+	}
+	if prev.Items != nil {
+		compare(prev.Items, next.Items, path+"/items", changes)
+	}
+	if prev.AdditionalProperties != nil {
+		compare(prev.AdditionalProperties, next.AdditionalProperties, path+"/additionalProperties", changes)
+	}
+}
+
+func sameTypes(a, b Types) bool {
+	as, bs := set(a), set(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for t := range as {
+		if !bs[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func typeString(t Types) string {
+	if len(t) == 0 {
+		return "any"
+	}
+	return strings.Join(t, " or ")
+}
+
+func constString(c *string) string {
+	if c == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%q", *c)
+}
+
+func set(values []string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+func sortedKeys(m map[string]*Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
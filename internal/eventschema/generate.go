@@ -0,0 +1,132 @@
+package eventschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// EnvelopeFileName is the file the schema of the envelope with any payload is written to.
+const EnvelopeFileName = "envelope.schema.json"
+
+// File is a generated schema and the file name it is written to.
+type File struct {
+	Name   string
+	Schema *Schema
+}
+
+// Generate returns the envelope schema and one schema per event registered with r.
+func Generate(r *events.Registry) ([]File, error) {
+	env := Envelope()
+	env.SchemaURI = Draft
+	env.ID = idPrefix + "envelope"
+	env.Title = "Event envelope"
+	files := []File{{Name: EnvelopeFileName, Schema: env}}
+	for _, reg := range r.Registrations() {
+		s, err := ForEvent(reg)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: FileName(reg.EventType, reg.Version), Schema: s})
+	}
+	return files, nil
+}
+
+// Marshal encodes the schema as indented JSON with a trailing newline.
+func (f File) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(f.Schema, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s: %w", f.Name, err)
+	}
+	return append(data, '\n'), nil
+}
+
+// CheckDir checks files against the schemas previously written to dir: every existing schema must
+// still be generated and each change must pass CheckCompatible. Schemas not in dir yet (new event
+// types or versions) are always accepted.
+func CheckDir(dir string, files []File) error {
+	generated := make(map[string]bool, len(files))
+	var errs []error
+	for _, f := range files {
+		generated[f.Name] = true
+		prev, err := readSchema(filepath.Join(dir, f.Name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := CheckCompatible(prev, f.Schema); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+		}
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.schema.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range existing {
+		if name := filepath.Base(path); !generated[name] {
+			errs = append(errs, fmt.Errorf("%s: %w: the event version was removed", name, ErrIncompatible))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stale returns the names of files whose content differs from what is written in dir.
+func Stale(dir string, files []File) ([]string, error) {
+	var stale []string
+	for _, f := range files {
+		want, err := f.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		got, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if !bytes.Equal(got, want) {
+			stale = append(stale, f.Name)
+		}
+	}
+	return stale, nil
+}
+
+// Write writes files to dir, creating it if needed.
+func Write(dir string, files []File) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		data, err := f.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, f.Name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSchema(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: unsupported schema: %w", filepath.Base(path), err)
+	}
+	if !strings.HasPrefix(s.ID, idPrefix) {
+		return nil, fmt.Errorf("%s: $id %q is not a generated schema", filepath.Base(path), s.ID)
+	}
+	return &s, nil
+}
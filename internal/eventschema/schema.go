@@ -0,0 +1,174 @@
+// Package eventschema generates JSON Schemas (draft 2020-12) for the events in pkg/events, validates
+// documents against them and checks that a new schema for an existing version stays backward compatible.
+// Only the subset of JSON Schema the generator emits is supported.
+package eventschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// Draft is the JSON Schema dialect of generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// idPrefix starts the $id of generated schemas; it matches the CloudEvents dataschema.
+const idPrefix = "urn:serverless-user-service:schema:"
+
+// Schema is a JSON Schema document or subschema.
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Const                *string            `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+}
+
+// Types is the "type" keyword: a single JSON type, or a list such as ["array", "null"].
+type Types []string
+
+// MarshalJSON encodes a single type as a string.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON accepts a string or a list of strings.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// FileName is the file the schema for eventType at version is written to, e.g. "user.created.v1.schema.json".
+func FileName(eventType, version string) string {
+	return eventType + ".v" + version + ".schema.json"
+}
+
+// ForEvent returns the schema of the envelope carrying reg's payload: eventType and version are
+// constants and payload is the schema of reg.PayloadType.
+func ForEvent(reg events.Registration) (*Schema, error) {
+	payload, err := FromType(reg.PayloadType)
+	if err != nil {
+		return nil, fmt.Errorf("%s v%s: %w", reg.EventType, reg.Version, err)
+	}
+	payload.Title = reg.PayloadType.Name()
+	env := Envelope()
+	env.SchemaURI = Draft
+	env.ID = idPrefix + reg.EventType + "/v" + reg.Version
+	env.Title = reg.EventType + " v" + reg.Version
+	env.Properties["eventType"].Const = &reg.EventType
+	env.Properties["version"].Const = &reg.Version
+	env.Properties["payload"] = payload
+	return env, nil
+}
+
+// Envelope returns the schema of events.Envelope with an unconstrained payload.
+func Envelope() *Schema {
+	s, err := FromType(reflect.TypeOf(events.Envelope{}))
+	if err != nil {
+		panic(err) // Envelope only has supported field types
+	}
+	s.Properties["occurredAt"].Format = "date-time"
+	return s
+}
+
+// FromType returns the schema of the JSON encoding/json produces for t. Struct fields follow their
+// json tags; fields without omitempty are required, and slices, maps and pointers may be null.
+// Objects allow properties other than their fields, so adding a field stays compatible.
+func FromType(t reflect.Type) (*Schema, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}, nil
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Ptr:
+		s, err := FromType(t.Elem())
+		return nullable(s), err
+	case reflect.Slice, reflect.Array:
+		items, err := FromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s := &Schema{Type: Types{"array"}, Items: items}
+		if t.Kind() == reflect.Slice {
+			s = nullable(s)
+		}
+		return s, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := FromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(&Schema{Type: Types{"object"}, AdditionalProperties: values}), nil
+	case reflect.Struct:
+		return fromStruct(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func fromStruct(t reflect.Type) (*Schema, error) {
+	s := &Schema{Type: Types{"object"}, Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !(f.Anonymous && f.Type.Kind() == reflect.Struct)) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			// Embedded struct fields are promoted, as encoding/json does
+			embedded, err := fromStruct(f.Type)
+			if err != nil {
+				return nil, err
+			}
+			for n, p := range embedded.Properties {
+				s.Properties[n] = p
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		p, err := FromType(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		s.Properties[name] = p
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s, nil
+}
+
+func nullable(s *Schema) *Schema {
+	if s != nil && len(s.Type) > 0 {
+		s.Type = append(s.Type, "null")
+	}
+	return s
+}
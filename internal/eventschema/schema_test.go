@@ -0,0 +1,177 @@
+package eventschema
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// schemaDir holds the committed schemas, relative to this package.
+const schemaDir = "../../pkg/events/schemas"
+
+// samples has one envelope per event registered in events.DefaultRegistry.
+var samples = []events.Envelope{
+	events.NewUserCreatedEnvelope("2024-01-01T00:00:00Z", events.UserCreatedV1{UserID: "u1", Email: "a@example.com", Name: "A", CreatedAt: "2024-01-01T00:00:00Z", CreatedBy: "admin", RequestID: "r1"}),
+	events.NewUserUpdatedEnvelope("2024-01-02T00:00:00Z", events.UserUpdatedV1{UserID: "u1", Email: "a@example.com", Name: "B", ChangedFields: []string{"name"}, UpdatedAt: "2024-01-02T00:00:00Z", UpdatedBy: "admin"}),
+	events.NewUserDeletedEnvelope("2024-01-03T00:00:00Z", events.UserDeletedV1{UserID: "u1", DeletedAt: "2024-01-03T00:00:00Z", DeletedBy: "admin"}),
+	events.NewUserRestoredEnvelope("2024-01-04T00:00:00Z", events.UserRestoredV1{UserID: "u1", RestoredAt: "2024-01-04T00:00:00Z", RestoredBy: "admin"}),
+}
+
+func TestEnvelopes_MatchSchemas(t *testing.T) {
+	files, err := Generate(events.DefaultRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed := make(map[string]*Schema)
+	for _, f := range files {
+		if committed[f.Name], err = readSchema(schemaDir + "/" + f.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	covered := make(map[string]bool)
+	for _, e := range samples {
+		name := FileName(e.EventType, e.Version)
+		covered[name] = true
+		for _, tenant := range []string{"", "acme"} {
+			e.TenantID = tenant
+			if tenant != "" {
+				e.Metadata = events.Metadata{EventID: "7f0c2a1e-0b1d-4c39-9d61-0d7c1c1f6a10", CorrelationID: "corr-1", CausationID: "req-1", Producer: "test"}
+			}
+			raw, err := events.MarshalEnvelope(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range []string{name, EnvelopeFileName} {
+				if err := Validate(committed[file], raw); err != nil {
+					t.Errorf("%s against %s: %v", raw, file, err)
+				}
+			}
+		}
+	}
+	for _, f := range files {
+		if !covered[f.Name] && f.Name != EnvelopeFileName {
+			t.Errorf("no sample envelope for %s", f.Name)
+		}
+	}
+}
+
+func TestCommittedSchemas_UpToDate(t *testing.T) {
+	files, err := Generate(events.DefaultRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckDir(schemaDir, files); err != nil {
+		t.Fatal(err)
+	}
+	if stale, err := Stale(schemaDir, files); err != nil || len(stale) > 0 {
+		t.Errorf("stale schemas %v (%v); run go run ./cmd/eventschema", stale, err)
+	}
+}
+
+func TestValidate_Rejects(t *testing.T) {
+	s, err := ForEvent(events.Registration{EventType: "user.updated", Version: "1", PayloadType: reflect.TypeOf(events.UserUpdatedV1{})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := `{"eventType":"user.updated","version":"1","occurredAt":"2024-01-02T00:00:00Z","payload":{"userId":"u1","email":"e","name":"n","changedFields":null,"updatedAt":"t","updatedBy":"b"}}`
+	if err := Validate(s, []byte(valid)); err != nil {
+		t.Fatalf("valid document: %v", err)
+	}
+	tests := []struct {
+		doc  string
+		want string
+	}{
+		{strings.Replace(valid, `"userId":"u1",`, "", 1), "/payload/userId: required"},
+		{strings.Replace(valid, `"changedFields":null`, `"changedFields":"name"`, 1), "/payload/changedFields: got string, want array or null"},
+		{strings.Replace(valid, `"changedFields":null`, `"changedFields":[1]`, 1), "/payload/changedFields/0: got integer, want string"},
+		{strings.Replace(valid, `"version":"1"`, `"version":"2"`, 1), `/version: got 2, want "1"`},
+		{strings.Replace(valid, `2024-01-02T00:00:00Z`, `yesterday`, 1), `/occurredAt: "yesterday" is not a date-time`},
+		{`[]`, "/: got array, want object"},
+	}
+	for _, tt := range tests {
+		err := Validate(s, []byte(tt.doc))
+		if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.doc, tt.want, err)
+		}
+	}
+}
+
+type payloadV1 struct {
+	ID    string   `json:"id"`
+	Tags  []string `json:"tags"`
+	Note  string   `json:"note,omitempty"`
+	Count int      `json:"count"`
+}
+
+func TestCheckCompatible(t *testing.T) {
+	tests := []struct {
+		name string
+		next interface{}
+		want string // empty when compatible
+	}{
+		{"unchanged", payloadV1{}, ""},
+		{"optional field added", struct {
+			payloadV1
+			Extra string `json:"extra,omitempty"`
+		}{}, ""},
+		{"field removed", struct {
+			ID    string   `json:"id"`
+			Tags  []string `json:"tags"`
+			Count int      `json:"count"`
+		}{}, "/payload/note: removed"},
+		{"type changed", struct {
+			ID    string   `json:"id"`
+			Tags  []string `json:"tags"`
+			Note  string   `json:"note,omitempty"`
+			Count string   `json:"count"`
+		}{}, "/payload/count: type changed from integer to string"},
+		{"item type changed", struct {
+			ID    string `json:"id"`
+			Tags  []int  `json:"tags"`
+			Note  string `json:"note,omitempty"`
+			Count int    `json:"count"`
+		}{}, "/payload/tags/items: type changed from string to integer"},
+		{"required field added", struct {
+			payloadV1
+			Extra string `json:"extra"`
+		}{}, "/payload/extra: newly required"},
+		{"field made optional", struct {
+			ID    string   `json:"id,omitempty"`
+			Tags  []string `json:"tags"`
+			Note  string   `json:"note,omitempty"`
+			Count int      `json:"count"`
+		}{}, "/payload/id: no longer required"},
+	}
+	prev := testSchema(t, "1", payloadV1{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCompatible(prev, testSchema(t, "1", tt.next))
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("expected compatible, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrIncompatible) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := CheckCompatible(prev, testSchema(t, "2", payloadV1{})); err == nil || !strings.Contains(err.Error(), "/version: const changed") {
+		t.Errorf("expected a const change, got %v", err)
+	}
+}
+
+func testSchema(t *testing.T, version string, payload interface{}) *Schema {
+	t.Helper()
+	s, err := ForEvent(events.Registration{EventType: "test.event", Version: version, PayloadType: reflect.TypeOf(payload)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,110 @@
+package eventschema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned by Validate when a document does not match its schema.
+var ErrInvalid = errors.New("document does not match schema")
+
+// Validate checks that the JSON document data matches s. The error lists every mismatch by its
+// JSON pointer, e.g. "/payload/userId: required".
+func Validate(s *Schema, data []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("unmarshal document: %w", err)
+	}
+	var problems []string
+	validate(s, doc, "", &problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalid, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func validate(s *Schema, v interface{}, path string, problems *[]string) {
+	fail := func(format string, args ...interface{}) {
+		p := path
+		if p == "" {
+			p = "/"
+		}
+		*problems = append(*problems, p+": "+fmt.Sprintf(format, args...))
+	}
+	if len(s.Type) > 0 && !s.Type.allows(v) {
+		fail("got %s, want %s", jsonType(v), strings.Join(s.Type, " or "))
+		return
+	}
+	if s.Const != nil && v != *s.Const {
+		fail("got %v, want %q", v, *s.Const)
+	}
+	if s.Format == "date-time" {
+		if str, ok := v.(string); ok {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				fail("%q is not a date-time", str)
+			}
+		}
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, path+"/"+name+": required")
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				validate(p, v[name], path+"/"+name, problems)
+			} else if s.AdditionalProperties != nil {
+				validate(s.AdditionalProperties, v[name], path+"/"+name, problems)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				validate(s.Items, item, fmt.Sprintf("%s/%d", path, i), problems)
+			}
+		}
+	}
+}
+
+func (t Types) allows(v interface{}) bool {
+	got := jsonType(v)
+	for _, want := range t {
+		if want == got || (want == "number" && got == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type of a value decoded by encoding/json.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
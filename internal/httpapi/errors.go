@@ -1,18 +1,101 @@
 package httpapi
 
-import "fmt"
+import (
+	"encoding/json"
+	"log/slog"
 
-// HTTPError represents an HTTP-level error with status code and message.
-type HTTPError struct {
-	StatusCode int
-	Message    string
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const contentTypeProblem = "application/problem+json"
+
+// problemTypePrefix prefixes the error code to form the problem type URI.
+const problemTypePrefix = "urn:serverless-user-service:problem:"
+
+// CodeInternal is the problem code for untyped errors.
+const CodeInternal = "internal_error"
+
+// ProblemDetails is an RFC 7807 problem document. Code repeats the last part of Type for clients
+// that prefer a plain string.
+type ProblemDetails struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"` // the API Gateway request id
+	Code     string              `json:"code"`
+	Errors   []apperr.FieldError `json:"errors,omitempty"`
+}
+
+var kindStatus = map[apperr.Kind]int{
+	apperr.KindValidation:           400,
+	apperr.KindUnauthorized:         401,
+	apperr.KindForbidden:            403,
+	apperr.KindNotFound:             404,
+	apperr.KindConflict:             409,
+	apperr.KindPrecondition:         412,
+	apperr.KindUnprocessable:        422,
+	apperr.KindPreconditionRequired: 428,
+	apperr.KindUnavailable:          503,
+}
+
+var statusTitle = map[int]string{
+	400: "Bad Request",
+	401: "Unauthorized",
+	403: "Forbidden",
+	404: "Not Found",
+	405: "Method Not Allowed",
+	409: "Conflict",
+	412: "Precondition Failed",
+	422: "Unprocessable Content",
+	428: "Precondition Required",
+	500: "Internal Server Error",
+	503: "Service Unavailable",
+}
+
+// Problem maps err to a problem+json response; instance is the request id. This is the single mapping
+// from apperr errors to HTTP: the Kind gives the status and the Code the type. Any other error becomes
+// an opaque 500, so callers should log it first.
+func Problem(err error, instance string) events.APIGatewayV2HTTPResponse {
+	e, ok := apperr.As(err)
+	if !ok {
+		return ProblemResponse(newProblem(500, CodeInternal, "internal server error", instance))
+	}
+	status, ok := kindStatus[e.Kind]
+	if !ok {
+		slog.Error("unknown error kind", "kind", e.Kind, "code", e.Code)
+		return ProblemResponse(newProblem(500, CodeInternal, "internal server error", instance))
+	}
+	p := newProblem(status, e.Code, e.Detail, instance)
+	p.Errors = e.Fields
+	return ProblemResponse(p)
 }
 
-func (e *HTTPError) Error() string {
-	return fmt.Sprintf("http %d: %s", e.StatusCode, e.Message)
+func newProblem(status int, code, detail, instance string) ProblemDetails {
+	return ProblemDetails{
+		Type:     problemTypePrefix + code,
+		Title:    statusTitle[status],
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	}
 }
 
-// NewHTTPError returns an HTTPError.
-func NewHTTPError(statusCode int, message string) *HTTPError {
-	return &HTTPError{StatusCode: statusCode, Message: message}
+// ProblemResponse encodes p as an application/problem+json response with status p.Status.
+func ProblemResponse(p ProblemDetails) events.APIGatewayV2HTTPResponse {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		slog.Error("failed to marshal problem", "error", err)
+		raw = []byte(`{"type":"` + problemTypePrefix + CodeInternal + `","title":"Internal Server Error","status":500,"code":"` + CodeInternal + `"}`)
+		p.Status = 500
+	}
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: p.Status,
+		Headers: map[string]string{
+			"Content-Type": contentTypeProblem,
+		},
+		Body: string(raw),
+	}
 }
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+)
+
+func TestProblem(t *testing.T) {
+	notFound := apperr.NotFound("user_not_found", "user not found")
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"validation", apperr.Invalid(
+			apperr.FieldError{Field: "id", Code: "required", Message: "id is required"},
+			apperr.FieldError{Field: "name", Code: "required", Message: "name is required"},
+		), 400, "validation_failed", "id is required; name is required"},
+		{"unauthorized", apperr.Unauthorized("missing_claim", "missing sub claim"), 401, "missing_claim", "missing sub claim"},
+		{"forbidden", apperr.Forbidden("forbidden", "not allowed"), 403, "forbidden", "not allowed"},
+		{"wrapped not found", fmt.Errorf("get: %w", notFound.Wrap(errors.New("dynamo"))), 404, "user_not_found", "user not found"},
+		{"conflict", apperr.Conflict("email_in_use", "email already in use"), 409, "email_in_use", "email already in use"},
+		{"unprocessable", apperr.Unprocessable("idempotency_key_reused", "reused"), 422, "idempotency_key_reused", "reused"},
+		{"unavailable", apperr.Unavailable("request_timeout", "request timed out"), 503, "request_timeout", "request timed out"},
+		{"untyped", errors.New("secret dynamo failure"), 500, CodeInternal, "internal server error"},
+	}
+	for _, tt := range tests {
+		resp := Problem(tt.err, "req-1")
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if ct := resp.Headers["Content-Type"]; ct != "application/problem+json" {
+			t.Errorf("%s: Content-Type = %q", tt.name, ct)
+		}
+		var p ProblemDetails
+		if err := json.Unmarshal([]byte(resp.Body), &p); err != nil {
+			t.Fatalf("%s: decode %s: %v", tt.name, resp.Body, err)
+		}
+		if p.Status != tt.status || p.Code != tt.code || p.Detail != tt.detail || p.Instance != "req-1" {
+			t.Errorf("%s: problem = %+v", tt.name, p)
+		}
+		if p.Type != "urn:serverless-user-service:problem:"+tt.code || p.Title == "" {
+			t.Errorf("%s: type = %q, title = %q", tt.name, p.Type, p.Title)
+		}
+	}
+
+	var p ProblemDetails
+	_ = json.Unmarshal([]byte(Problem(tests[0].err, "").Body), &p)
+	if len(p.Errors) != 2 || p.Errors[1].Field != "name" || p.Errors[1].Code != "required" {
+		t.Errorf("field errors = %+v", p.Errors)
+	}
+	if !errors.Is(tests[3].err, notFound) {
+		t.Error("wrapped error should match its sentinel")
+	}
+}
+
+func TestJSON_MarshalFailure(t *testing.T) {
+	resp := JSON(200, map[string]interface{}{"bad": make(chan int)})
+	var p ProblemDetails
+	if err := json.Unmarshal([]byte(resp.Body), &p); err != nil {
+		t.Fatalf("decode %s: %v", resp.Body, err)
+	}
+	if resp.StatusCode != 500 || resp.Headers["Content-Type"] != "application/problem+json" || p.Status != 500 || p.Code != CodeInternal {
+		t.Errorf("status %d, headers %v, problem %+v", resp.StatusCode, resp.Headers, p)
+	}
+}
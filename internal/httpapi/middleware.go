@@ -0,0 +1,131 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Chain applies middlewares to h; the first middleware is the outermost.
+func Chain(h Handler, mw ...Middleware) Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Recover turns a panic in the handler into a 500 response.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (resp events.APIGatewayV2HTTPResponse, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					slog.Error("handler panic", "requestId", req.RequestContext.RequestID, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+					resp, err = Problem(fmt.Errorf("panic: %v", p), req.RequestContext.RequestID), nil
+				}
+			}()
+			return next(ctx, req)
+		}
+	}
+}
+
+// Logger logs every request and its outcome.
+func Logger() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+			start := time.Now()
+			method, path, requestID := req.RequestContext.HTTP.Method, req.RawPath, req.RequestContext.RequestID
+			slog.Info("incoming request", "method", method, "path", path, "requestId", requestID, "requesterSub", req.Claim("sub"))
+			resp, err := next(ctx, req)
+			slog.Info("request completed", "method", method, "path", path, "requestId", requestID, "status", resp.StatusCode, "durationMs", time.Since(start).Milliseconds())
+			return resp, err
+		}
+	}
+}
+
+// RequireClaim rejects requests whose JWT lacks the claim (e.g. "sub") with 401 missing_claim.
+func RequireClaim(name string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+			if req.Claim(name) == "" {
+				slog.Warn("missing JWT claims", "requestId", req.RequestContext.RequestID, "claim", name)
+				return Problem(apperr.Unauthorized("missing_claim", "missing "+name+" claim"), req.RequestContext.RequestID), nil
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// Timeout bounds the handler by the time left on the Lambda invocation minus margin, which is kept
+// for writing the response. When the budget runs out the handler's context is cancelled (aborting
+// DynamoDB/SQS calls) and 503 request_timeout is returned instead of waiting for Lambda to kill the invocation.
+// A handler that has returned by then is answered with its own response, so committed writes are reported.
+// Requests whose context has no deadline are not bounded. The handler runs on its own goroutine,
+// so Recover must be placed after Timeout in the chain to catch its panics.
+func Timeout(margin time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				return next(ctx, req)
+			}
+			requestID := req.RequestContext.RequestID
+			budget := time.Until(deadline) - margin
+			if budget <= 0 {
+				slog.Warn("no time budget left", "requestId", requestID)
+				return Problem(errRequestTimeout, requestID), nil
+			}
+			ctx, cancel := context.WithTimeout(ctx, budget)
+			defer cancel()
+
+			done := make(chan handlerResult, 1)
+			go func() {
+				resp, err := next(ctx, req)
+				done <- handlerResult{resp, err}
+			}()
+			if res, ok := awaitHandler(ctx, done); ok {
+				return res.resp, res.err
+			}
+			slog.Warn("request timed out", "requestId", requestID, "budgetMs", budget.Milliseconds())
+			return Problem(errRequestTimeout, requestID), nil
+		}
+	}
+}
+
+type handlerResult struct {
+	resp events.APIGatewayV2HTTPResponse
+	err  error
+}
+
+// awaitHandler waits for the handler's result or the end of ctx, reporting false on a timeout. A result
+// that is ready is returned even if ctx ended meanwhile: the handler's writes are committed, and a
+// 503 would make the client retry into a conflict.
+func awaitHandler(ctx context.Context, done <-chan handlerResult) (handlerResult, bool) {
+	select {
+	case res := <-done:
+		return res, true
+	case <-ctx.Done():
+		select {
+		case res := <-done:
+			return res, true
+		default:
+			return handlerResult{}, false
+		}
+	}
+}
+
+var errRequestTimeout = apperr.Unavailable("request_timeout", "request timed out")
+
+// Claim returns a JWT claim set by the API Gateway JWT authorizer, or "" if absent.
+func (r *Request) Claim(name string) string {
+	a := r.RequestContext.Authorizer
+	if a == nil || a.JWT == nil {
+		return ""
+	}
+	return a.JWT.Claims[name]
+}
@@ -0,0 +1,202 @@
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ClaimsHeader lets a local caller add or override JWT claims per request, as a JSON object.
+// It is only honoured by NewHTTPHandler and never reaches a Handler.
+const ClaimsHeader = "X-Local-Claims"
+
+// ClaimsFunc returns the JWT claims to inject for r, as API Gateway's JWT authorizer would.
+// Returning nil leaves the request unauthenticated.
+type ClaimsFunc func(r *http.Request) map[string]string
+
+// StaticClaims returns a ClaimsFunc that injects base on every request, merged with the JSON object in
+// the ClaimsHeader if present (header claims win). An empty value in the header drops that claim, which
+// lets a caller exercise the 401 path. Invalid header JSON is ignored and logged.
+func StaticClaims(base map[string]string) ClaimsFunc {
+	return func(r *http.Request) map[string]string {
+		claims := make(map[string]string, len(base))
+		for k, v := range base {
+			claims[k] = v
+		}
+		if raw := r.Header.Get(ClaimsHeader); raw != "" {
+			var extra map[string]string
+			if err := json.Unmarshal([]byte(raw), &extra); err != nil {
+				slog.Warn("ignoring invalid claims header", "header", ClaimsHeader, "error", err)
+			}
+			for k, v := range extra {
+				if v == "" {
+					delete(claims, k)
+					continue
+				}
+				claims[k] = v
+			}
+		}
+		if len(claims) == 0 {
+			return nil
+		}
+		return claims
+	}
+}
+
+// NewHTTPHandler serves router over net/http, translating each request into an API Gateway HTTP API
+// (payload v2.0) event and the response back. It is meant for running the API locally; claims stands
+// in for the JWT authorizer.
+func NewHTTPHandler(router *Router, claims ClaimsFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var c map[string]string
+		if claims != nil {
+			c = claims(r)
+		}
+		req, err := ToAPIGatewayRequest(r, c)
+		if err != nil {
+			slog.Error("failed to read request body", "error", err)
+			WriteAPIGatewayResponse(w, Problem(apperr.Validation("invalid_body", "request body could not be read"), ""))
+			return
+		}
+		resp, err := router.Handle(r.Context(), req)
+		if err != nil {
+			slog.Error("handler returned error", "requestId", req.RequestContext.RequestID, "error", err)
+			resp = Problem(err, req.RequestContext.RequestID)
+		}
+		WriteAPIGatewayResponse(w, resp)
+	})
+}
+
+// ToAPIGatewayRequest converts r into the event API Gateway would send for it. Multi-valued headers and
+// query parameters are joined with "," as API Gateway does. claims, if non-nil, are set as JWT authorizer claims.
+func ToAPIGatewayRequest(r *http.Request, claims map[string]string) (events.APIGatewayV2HTTPRequest, error) {
+	var body []byte
+	if r.Body != nil {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return events.APIGatewayV2HTTPRequest{}, err
+		}
+		body = b
+	}
+
+	headers := make(map[string]string, len(r.Header))
+	for name, values := range r.Header {
+		if strings.EqualFold(name, ClaimsHeader) || strings.EqualFold(name, "Cookie") {
+			continue
+		}
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	if r.Host != "" {
+		headers["host"] = r.Host
+	}
+
+	var query map[string]string
+	if q := r.URL.Query(); len(q) > 0 {
+		query = make(map[string]string, len(q))
+		for name, values := range q {
+			query[name] = strings.Join(values, ",")
+		}
+	}
+
+	var cookies []string
+	for _, c := range r.Cookies() {
+		cookies = append(cookies, c.Name+"="+c.Value)
+	}
+
+	sourceIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		sourceIP = host
+	}
+
+	now := time.Now().UTC()
+	req := events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RouteKey:              "$default",
+		RawPath:               r.URL.EscapedPath(),
+		RawQueryString:        r.URL.RawQuery,
+		Cookies:               cookies,
+		Headers:               headers,
+		QueryStringParameters: query,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RouteKey:   "$default",
+			AccountID:  "local",
+			Stage:      "$default",
+			RequestID:  newLocalRequestID(),
+			APIID:      "local",
+			DomainName: r.Host,
+			Time:       now.Format("02/Jan/2006:15:04:05 -0700"),
+			TimeEpoch:  now.UnixMilli(),
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Protocol:  r.Proto,
+				SourceIP:  sourceIP,
+				UserAgent: r.UserAgent(),
+			},
+		},
+	}
+	if utf8.Valid(body) {
+		req.Body = string(body)
+	} else {
+		req.Body = base64.StdEncoding.EncodeToString(body)
+		req.IsBase64Encoded = true
+	}
+	if claims != nil {
+		req.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: claims},
+		}
+	}
+	return req, nil
+}
+
+// WriteAPIGatewayResponse writes resp to w the way API Gateway would return it to the client.
+func WriteAPIGatewayResponse(w http.ResponseWriter, resp events.APIGatewayV2HTTPResponse) {
+	body := []byte(resp.Body)
+	if resp.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(resp.Body)
+		if err != nil {
+			slog.Error("invalid base64 response body", "error", err)
+			resp = Problem(err, "")
+			body = []byte(resp.Body)
+		} else {
+			body = b
+		}
+	}
+	h := w.Header()
+	for name, values := range resp.MultiValueHeaders {
+		for _, v := range values {
+			h.Add(name, v)
+		}
+	}
+	for name, v := range resp.Headers {
+		h.Set(name, v)
+	}
+	for _, c := range resp.Cookies {
+		h.Add("Set-Cookie", c)
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	status := resp.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func newLocalRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return "local-" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestNewHTTPHandler_RoundTrip(t *testing.T) {
+	var got *Request
+	r := NewRouter()
+	r.Use(RequireClaim("sub"))
+	r.Register("POST", "/users/{id}:restore", func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		got = req
+		resp := JSON(201, map[string]string{"ok": "yes"})
+		resp.Cookies = []string{"session=abc"}
+		return resp, nil
+	})
+	srv := httptest.NewServer(NewHTTPHandler(r, StaticClaims(map[string]string{"sub": "local-user", "scope": "users:read"})))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("POST", srv.URL+"/users/a%40b:restore?x=1&x=2&y=3", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Idempotency-Key", "k1")
+	req.Header.Set(ClaimsHeader, `{"scope":"users:write","email":"dev@example.com"}`)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 201 || strings.TrimSpace(string(body)) != `{"ok":"yes"}` {
+		t.Fatalf("response = %d %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if c := resp.Header.Get("Set-Cookie"); c != "session=abc" {
+		t.Errorf("Set-Cookie = %q", c)
+	}
+	if got == nil {
+		t.Fatal("handler not called")
+	}
+	if id := got.PathParam("id"); id != "a@b" {
+		t.Errorf("id = %q, want a@b", id)
+	}
+	if got.RequestContext.HTTP.Method != "POST" || got.RawPath != "/users/a%40b:restore" {
+		t.Errorf("method/path = %s %s", got.RequestContext.HTTP.Method, got.RawPath)
+	}
+	if got.QueryStringParameters["x"] != "1,2" || got.QueryStringParameters["y"] != "3" {
+		t.Errorf("query = %v", got.QueryStringParameters)
+	}
+	if got.Headers["idempotency-key"] != "k1" {
+		t.Errorf("headers = %v", got.Headers)
+	}
+	if _, ok := got.Headers[strings.ToLower(ClaimsHeader)]; ok {
+		t.Error("claims header should not be forwarded")
+	}
+	if got.Body != `{"a":1}` || got.RequestContext.RequestID == "" {
+		t.Errorf("body = %q, requestId = %q", got.Body, got.RequestContext.RequestID)
+	}
+	if got.Claim("sub") != "local-user" || got.Claim("scope") != "users:write" || got.Claim("email") != "dev@example.com" {
+		t.Errorf("claims = %v", got.RequestContext.Authorizer.JWT.Claims)
+	}
+}
+
+func TestNewHTTPHandler_ClaimsHeaderCanDropClaim(t *testing.T) {
+	r := NewRouter()
+	r.Use(RequireClaim("sub"))
+	r.Register("GET", "/users", echo("list"))
+	h := NewHTTPHandler(r, StaticClaims(map[string]string{"sub": "local-user"}))
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set(ClaimsHeader, `{"sub":""}`)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 401 {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("DELETE", "/users", nil))
+	if rec.Code != 405 || rec.Header().Get("Allow") != "GET" {
+		t.Errorf("status = %d, Allow = %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
@@ -9,12 +9,13 @@ import (
 
 const contentTypeJSON = "application/json"
 
-// JSON writes statusCode and a JSON body with standard headers.
+// JSON writes statusCode and a JSON body with standard headers. If body cannot be encoded the
+// response is a 500 problem, like any other unexpected failure.
 func JSON(statusCode int, body interface{}) events.APIGatewayV2HTTPResponse {
 	raw, err := json.Marshal(body)
 	if err != nil {
 		slog.Error("failed to marshal response", "error", err)
-		return JSON(statusCode, map[string]string{"error": "internal error"})
+		return ProblemResponse(newProblem(500, CodeInternal, "internal server error", ""))
 	}
 	return events.APIGatewayV2HTTPResponse{
 		StatusCode: statusCode,
@@ -25,7 +26,18 @@ func JSON(statusCode int, body interface{}) events.APIGatewayV2HTTPResponse {
 	}
 }
 
-// ErrorResponse returns a JSON error response with the given status and message.
-func ErrorResponse(statusCode int, message string) events.APIGatewayV2HTTPResponse {
-	return JSON(statusCode, map[string]string{"error": message})
+// RawJSON returns statusCode with an already-encoded JSON body (e.g. a stored response being replayed).
+func RawJSON(statusCode int, body string) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": contentTypeJSON,
+		},
+		Body: body,
+	}
+}
+
+// Empty returns a response with statusCode and no body (e.g. 204 No Content).
+func Empty(statusCode int) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{StatusCode: statusCode}
 }
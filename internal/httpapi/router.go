@@ -1,50 +1,206 @@
 package httpapi
 
 import (
+	"context"
+	"net/url"
+	"sort"
 	"strings"
 
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
 	"github.com/aws/aws-lambda-go/events"
 )
 
-// Handler is the signature for a route handler.
-type Handler func(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+// Request is an API Gateway request together with the path parameters extracted by the Router.
+type Request struct {
+	events.APIGatewayV2HTTPRequest
+	PathParams map[string]string // e.g. {"id": "u1"} for pattern "/users/{id}"; values are unescaped
+}
+
+// PathParam returns the named path parameter, or "" if the route has no such parameter.
+func (r *Request) PathParam(name string) string {
+	return r.PathParams[name]
+}
 
-// Router dispatches by method and path (RawPath). Path params are not parsed here;
-// the handler receives the full request and can extract {id} from the path.
+// Handler is the signature for a route handler. ctx is the Lambda invocation context (carrying its
+// deadline and cancellation) as narrowed by middlewares.
+type Handler func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error)
+
+// Middleware wraps a Handler, e.g. for auth, logging or panic recovery.
+type Middleware func(Handler) Handler
+
+// Router dispatches by method and path pattern. Patterns are compiled at registration:
+// "/users/{id}/addresses/{addrId}" matches "/users/u1/addresses/a1" with params id=u1, addrId=a1.
+// A segment may add a literal suffix to a parameter, as in "/users/{id}:restore".
 type Router struct {
-	routes map[string]Handler // key: "METHOD /path" e.g. "POST /users"
+	routes      []*route
+	middlewares []Middleware
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  Handler
+}
+
+// segment is one "/"-separated part of a pattern: either a literal, or a parameter with an optional literal suffix.
+type segment struct {
+	literal string
+	param   string
+	suffix  string
 }
 
 // NewRouter returns a new Router.
 func NewRouter() *Router {
-	return &Router{routes: make(map[string]Handler)}
+	return &Router{}
+}
+
+// Use appends middlewares applied to every request, including 404 and 405 responses.
+// The first middleware is the outermost.
+func (r *Router) Use(mw ...Middleware) {
+	r.middlewares = append(r.middlewares, mw...)
+}
+
+// Register associates a handler with method and path pattern, e.g. "/users" or "/users/{id}".
+// mw are applied to this route only, inside the middlewares added with Use (e.g. authorization rules).
+func (r *Router) Register(method, pattern string, h Handler, mw ...Middleware) {
+	r.routes = append(r.routes, &route{method: method, segments: compilePattern(pattern), handler: Chain(h, mw...)})
+}
+
+func compilePattern(pattern string) []segment {
+	parts := splitPath(pattern)
+	segs := make([]segment, 0, len(parts))
+	for _, p := range parts {
+		if strings.HasPrefix(p, "{") {
+			if end := strings.Index(p, "}"); end > 0 {
+				segs = append(segs, segment{param: p[1:end], suffix: p[end+1:]})
+				continue
+			}
+		}
+		segs = append(segs, segment{literal: p})
+	}
+	return segs
 }
 
-// Register associates a handler with method and path.
-// Path should be the raw path pattern, e.g. "/users" or "/users/{id}".
-// For path params, the handler is responsible for extracting the id from RawPath.
-func (r *Router) Register(method, path string, h Handler) {
-	r.routes[method+" "+path] = h
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
 }
 
-// Route returns the handler for the given method and rawPath, or nil if not found.
-// Path matching: exact match for "/users"; for "/users/{id}" we match prefix "/users/" (handler extracts id from path).
-func (r *Router) Route(method, rawPath string) Handler {
-	path := strings.TrimSuffix(rawPath, "/")
+// Handle dispatches req to the matching route through the middleware chain. It responds 404 when no
+// pattern matches the path and 405 with an Allow header when patterns match but none for the method.
+func (r *Router) Handle(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	method := req.RequestContext.HTTP.Method
+	path := req.RawPath
 	if path == "" {
-		path = "/"
+		path = req.RequestContext.HTTP.Path
 	}
 
-	key := method + " " + path
-	if h, ok := r.routes[key]; ok {
-		return h
+	h, params, allowed := r.match(method, path)
+	if h == nil {
+		if len(allowed) > 0 {
+			h = methodNotAllowed(allowed)
+		} else {
+			h = notFound
+		}
 	}
-	// GET /users/{id}
-	const usersPrefix = "/users/"
-	if strings.HasPrefix(path, usersPrefix) && method == "GET" {
-		if h, ok := r.routes["GET /users/{id}"]; ok {
-			return h
+	h = Chain(h, r.middlewares...)
+	return h(ctx, &Request{APIGatewayV2HTTPRequest: req, PathParams: params})
+}
+
+// match returns the most specific route for method and path. If the path matches only routes for
+// other methods, it returns a nil handler and those methods.
+func (r *Router) match(method, path string) (Handler, map[string]string, []string) {
+	parts := splitPath(path)
+	var best *route
+	var bestParams map[string]string
+	allowed := map[string]bool{}
+	for _, rt := range r.routes {
+		params, ok := matchSegments(rt.segments, parts)
+		if !ok {
+			continue
+		}
+		if rt.method != method {
+			allowed[rt.method] = true
+			continue
+		}
+		if best == nil || moreSpecific(rt.segments, best.segments) {
+			best, bestParams = rt, params
 		}
 	}
-	return nil
+	if best != nil {
+		return best.handler, bestParams, nil
+	}
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return nil, nil, methods
+}
+
+func matchSegments(segs []segment, parts []string) (map[string]string, bool) {
+	if len(segs) != len(parts) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, seg := range segs {
+		part := parts[i]
+		if seg.param == "" {
+			if part != seg.literal {
+				return nil, false
+			}
+			continue
+		}
+		if !strings.HasSuffix(part, seg.suffix) || len(part) == len(seg.suffix) {
+			return nil, false
+		}
+		value, err := url.PathUnescape(strings.TrimSuffix(part, seg.suffix))
+		if err != nil {
+			return nil, false
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[seg.param] = value
+	}
+	return params, true
+}
+
+// moreSpecific reports whether a beats b: comparing segments left to right, a literal beats a
+// parameter and a parameter with a suffix beats a bare parameter.
+func moreSpecific(a, b []segment) bool {
+	for i := range a {
+		if sa, sb := specificity(a[i]), specificity(b[i]); sa != sb {
+			return sa > sb
+		}
+	}
+	return false
+}
+
+func specificity(s segment) int {
+	switch {
+	case s.param == "":
+		return 2
+	case s.suffix != "":
+		return 1
+	default:
+		return 0
+	}
+}
+
+var errRouteNotFound = apperr.NotFound("route_not_found", "no route matches the path")
+
+func notFound(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+	return Problem(errRouteNotFound, req.RequestContext.RequestID), nil
+}
+
+func methodNotAllowed(allowed []string) Handler {
+	return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		resp := ProblemResponse(newProblem(405, "method_not_allowed", "method not allowed", req.RequestContext.RequestID))
+		resp.Headers["Allow"] = strings.Join(allowed, ", ")
+		return resp, nil
+	}
 }
@@ -0,0 +1,193 @@
+package httpapi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func request(method, rawPath string) events.APIGatewayV2HTTPRequest {
+	return events.APIGatewayV2HTTPRequest{
+		RawPath: rawPath,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: method, Path: rawPath},
+		},
+	}
+}
+
+// echo returns a handler that responds with name and the given params as "name k=v ...".
+func echo(name string, params ...string) Handler {
+	return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		body := name
+		for _, p := range params {
+			body += " " + p + "=" + req.PathParam(p)
+		}
+		return events.APIGatewayV2HTTPResponse{StatusCode: 200, Body: body}, nil
+	}
+}
+
+func TestRouter_Handle(t *testing.T) {
+	r := NewRouter()
+	r.Register("GET", "/users", echo("list"))
+	r.Register("GET", "/users/{id}", echo("get", "id"))
+	r.Register("PATCH", "/users/{id}", echo("update", "id"))
+	r.Register("GET", "/users/me", echo("me"))
+	r.Register("POST", "/users/{id}:restore", echo("restore", "id"))
+	r.Register("GET", "/users/{id}/addresses/{addrId}", echo("address", "id", "addrId"))
+
+	tests := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/users", 200, "list"},
+		{"GET", "/users/", 200, "list"},
+		{"GET", "/users/u1", 200, "get id=u1"},
+		{"GET", "/users/u1/", 200, "get id=u1"},
+		{"GET", "/users/a%40b%2Fc", 200, "get id=a@b/c"},
+		{"PATCH", "/users/u1", 200, "update id=u1"},
+		{"GET", "/users/me", 200, "me"},
+		{"POST", "/users/u1:restore", 200, "restore id=u1"},
+		{"GET", "/users/u1/addresses/a9", 200, "address id=u1 addrId=a9"},
+		{"GET", "/nope", 404, ""},
+		{"GET", "/users/u1/extra", 404, ""},
+	}
+	for _, tt := range tests {
+		resp, err := r.Handle(context.Background(), request(tt.method, tt.path))
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.method, tt.path, err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.status, resp.StatusCode)
+			continue
+		}
+		if tt.body != "" && resp.Body != tt.body {
+			t.Errorf("%s %s: expected body %q, got %q", tt.method, tt.path, tt.body, resp.Body)
+		}
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	r := NewRouter()
+	r.Register("GET", "/users/{id}", echo("get"))
+	r.Register("PATCH", "/users/{id}", echo("update"))
+
+	resp, _ := r.Handle(context.Background(), request("DELETE", "/users/u1"))
+	if resp.StatusCode != 405 {
+		t.Fatalf("expected 405, got %d", resp.StatusCode)
+	}
+	if resp.Headers["Allow"] != "GET, PATCH" {
+		t.Errorf("unexpected Allow header %q", resp.Headers["Allow"])
+	}
+}
+
+func TestRouter_MiddlewareChain(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		}
+	}
+	r := NewRouter()
+	r.Use(Recover(), mark("a"), mark("b"))
+	r.Register("GET", "/boom", func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		panic("boom")
+	})
+
+	resp, err := r.Handle(context.Background(), request("GET", "/boom"))
+	if err != nil || resp.StatusCode != 500 {
+		t.Fatalf("expected recovered 500, got %d, err %v", resp.StatusCode, err)
+	}
+	if strings.Join(order, ",") != "a,b" {
+		t.Errorf("expected middlewares in order a,b, got %v", order)
+	}
+
+	order = nil
+	resp, _ = r.Handle(context.Background(), request("GET", "/missing"))
+	if resp.StatusCode != 404 || strings.Join(order, ",") != "a,b" {
+		t.Errorf("middlewares should wrap 404 too: status %d, order %v", resp.StatusCode, order)
+	}
+}
+
+func TestRequireClaim(t *testing.T) {
+	r := NewRouter()
+	r.Use(RequireClaim("sub"))
+	r.Register("GET", "/users", echo("list"))
+
+	resp, _ := r.Handle(context.Background(), request("GET", "/users"))
+	if resp.StatusCode != 401 {
+		t.Errorf("expected 401 without claims, got %d", resp.StatusCode)
+	}
+	req := request("GET", "/users")
+	req.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+		JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: map[string]string{"sub": "s1"}},
+	}
+	resp, _ = r.Handle(context.Background(), req)
+	if resp.StatusCode != 200 {
+		t.Errorf("expected 200 with sub claim, got %d", resp.StatusCode)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	r := NewRouter()
+	r.Use(Timeout(10 * time.Millisecond))
+	r.Register("GET", "/slow", func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		<-ctx.Done() // e.g. an SDK call aborted by cancellation, which returns a moment later
+		time.Sleep(20 * time.Millisecond)
+		return Problem(ctx.Err(), req.RequestContext.RequestID), nil
+	})
+	r.Register("GET", "/hang", func(ctx context.Context, req *Request) (events.APIGatewayV2HTTPResponse, error) {
+		time.Sleep(time.Second) // ignores ctx
+		return events.APIGatewayV2HTTPResponse{StatusCode: 200}, nil
+	})
+	r.Register("GET", "/fast", echo("fast"))
+
+	for _, path := range []string{"/slow", "/hang"} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		start := time.Now()
+		resp, err := r.Handle(ctx, request("GET", path))
+		cancel()
+		if err != nil || resp.StatusCode != 503 {
+			t.Errorf("%s: expected 503, got %d, err %v", path, resp.StatusCode, err)
+		}
+		if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+			t.Errorf("%s: took %v, should stop at the budget", path, elapsed)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, _ := r.Handle(ctx, request("GET", "/fast"))
+	if resp.StatusCode != 200 {
+		t.Errorf("/fast: expected 200, got %d", resp.StatusCode)
+	}
+	resp, _ = r.Handle(context.Background(), request("GET", "/fast"))
+	if resp.StatusCode != 200 {
+		t.Errorf("/fast without deadline: expected 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestAwaitHandler_ResultAtDeadline(t *testing.T) {
+	// The handler committed its write and sent its result just as the budget ran out: both are ready
+	// when the middleware looks, and the result must win over the 503
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 100; i++ {
+		done := make(chan handlerResult, 1)
+		done <- handlerResult{resp: events.APIGatewayV2HTTPResponse{StatusCode: 201}}
+		if res, ok := awaitHandler(ctx, done); !ok || res.resp.StatusCode != 201 {
+			t.Fatalf("got %d, ok %v; want the handler's 201", res.resp.StatusCode, ok)
+		}
+	}
+
+	// Without a result the expired context is a timeout
+	if _, ok := awaitHandler(ctx, make(chan handlerResult, 1)); ok {
+		t.Error("expected a timeout without a result")
+	}
+}
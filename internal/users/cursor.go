@@ -0,0 +1,53 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or has been tampered with.
+var ErrInvalidCursor = apperr.Validation("invalid_cursor", "invalid cursor",
+	apperr.FieldError{Field: "cursor", Code: "invalid", Message: "cursor was not issued by this API or has been modified"})
+
+// encodeCursor serializes a position (e.g. a DynamoDB LastEvaluatedKey) into an opaque token.
+// The token is base64url(JSON) + "." + base64url(HMAC-SHA256), so clients cannot forge positions.
+func encodeCursor(key []byte, pos map[string]string) (string, error) {
+	raw, err := json.Marshal(pos)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(signCursor(key, payload)), nil
+}
+
+// decodeCursor verifies and parses a token produced by encodeCursor. Returns ErrInvalidCursor on any failure.
+func decodeCursor(key []byte, cursor string) (map[string]string, error) {
+	payload, sig, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, signCursor(key, payload)) {
+		return nil, ErrInvalidCursor
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var pos map[string]string
+	if err := json.Unmarshal(raw, &pos); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return pos, nil
+}
+
+func signCursor(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+package users
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Conditional request headers. A user's ETag is its version as a strong entity tag, e.g. "3".
+const (
+	ETagHeader        = "ETag"
+	IfMatchHeader     = "If-Match"
+	IfNoneMatchHeader = "If-None-Match"
+)
+
+var errPreconditionRequired = apperr.PreconditionRequired("precondition_required", IfMatchHeader+" header is required")
+
+// ETag returns the entity tag of a user at version v.
+func ETag(v int64) string {
+	return `"` + strconv.FormatInt(v, 10) + `"`
+}
+
+// parseETag returns the version in a strong entity tag produced by ETag.
+func parseETag(tag string) (int64, bool) {
+	tag = strings.TrimSpace(tag)
+	if len(tag) < 3 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// ifMatchOptions turns the If-Match header of a mutating request into write options. The header is
+// required; "*" writes unconditionally. A tag that is not one of ours can never match, so it fails
+// with ErrVersionMismatch like a stale one.
+func ifMatchOptions(headers map[string]string) ([]WriteOption, error) {
+	raw := strings.TrimSpace(headerValue(headers, IfMatchHeader))
+	switch raw {
+	case "":
+		return nil, errPreconditionRequired
+	case "*":
+		return nil, nil
+	}
+	v, ok := parseETag(raw)
+	if !ok {
+		return nil, ErrVersionMismatch
+	}
+	return []WriteOption{IfVersion(v)}, nil
+}
+
+// noneMatch reports whether the If-None-Match header lists the current ETag of u (or is "*").
+// Weak tags compare equal to strong ones, as RFC 9110 requires for If-None-Match.
+func noneMatch(headers map[string]string, u *User) bool {
+	raw := headerValue(headers, IfNoneMatchHeader)
+	if strings.TrimSpace(raw) == "*" {
+		return true
+	}
+	current := ETag(u.Version)
+	for _, tag := range strings.Split(raw, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// userResponse writes u as JSON with its ETag.
+func userResponse(statusCode int, u *User) events.APIGatewayV2HTTPResponse {
+	resp := httpapi.JSON(statusCode, u)
+	resp.Headers[ETagHeader] = ETag(u.Version)
+	return resp
+}
+
+// notModified answers a GET whose If-None-Match matched u with 304 and no body.
+func notModified(u *User) events.APIGatewayV2HTTPResponse {
+	resp := httpapi.Empty(304)
+	resp.Headers = map[string]string{ETagHeader: ETag(u.Version)}
+	return resp
+}
@@ -0,0 +1,80 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// EventBridgeAPI is the part of the EventBridge client used by EventBridgePublisher.
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventBridgePublisher puts user events on an EventBridge bus. The detail-type is the envelope's
+// EventType (e.g. "user.created") and the detail is the whole envelope, so rules can match on
+// detail.version or detail.tenantId.
+type EventBridgePublisher struct {
+	client  EventBridgeAPI
+	busName string
+	source  string
+}
+
+// NewEventBridgePublisher returns an EventBridgePublisher for the bus busName and events from source.
+func NewEventBridgePublisher(client EventBridgeAPI, busName, source string) *EventBridgePublisher {
+	return &EventBridgePublisher{client: client, busName: busName, source: source}
+}
+
+// PublishUserCreated puts a UserCreated event on the bus.
+func (p *EventBridgePublisher) PublishUserCreated(ctx context.Context, payload UserCreatedEventPayload) error {
+	return p.send(ctx, userCreatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserUpdated puts a UserUpdated event on the bus.
+func (p *EventBridgePublisher) PublishUserUpdated(ctx context.Context, payload UserUpdatedEventPayload) error {
+	return p.send(ctx, userUpdatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserDeleted puts a UserDeleted event on the bus.
+func (p *EventBridgePublisher) PublishUserDeleted(ctx context.Context, payload UserDeletedEventPayload) error {
+	return p.send(ctx, userDeletedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserRestored puts a UserRestored event on the bus.
+func (p *EventBridgePublisher) PublishUserRestored(ctx context.Context, payload UserRestoredEventPayload) error {
+	return p.send(ctx, userRestoredEnvelope(payload), payload.UserID)
+}
+
+func (p *EventBridgePublisher) send(ctx context.Context, ev events.Envelope, userID string) error {
+	ev, err := withMetadata(ctx, ev, p.source)
+	if err != nil {
+		return err
+	}
+	detail, err := events.MarshalEnvelope(ev)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+	out, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: &p.busName,
+			Source:       &p.source,
+			DetailType:   aws.String(ev.EventType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	// PutEvents succeeds as a call even when entries are rejected; those are reported per entry
+	if err == nil && out.FailedEntryCount > 0 && len(out.Entries) > 0 {
+		err = fmt.Errorf("put event rejected: %s: %s", aws.ToString(out.Entries[0].ErrorCode), aws.ToString(out.Entries[0].ErrorMessage))
+	}
+	if err != nil {
+		slog.Error("EventBridge publish failed", "error", err, "eventType", ev.EventType)
+		return err
+	}
+	slog.Info("EventBridge publish success", "eventType", ev.EventType, "eventId", ev.EventID, "userId", userID)
+	return nil
+}
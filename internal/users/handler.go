@@ -5,101 +5,333 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
 	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
-const usersPathPrefix = "/users/"
-
 // Handler holds dependencies for user HTTP handlers.
 type Handler struct {
-	svc *Service
+	svc  *Service
+	idem IdempotencyStore
 }
 
-// NewHandler returns a new Handler.
-func NewHandler(svc *Service) *Handler {
-	return &Handler{svc: svc}
+// NewHandler returns a new Handler. idem may be nil, in which case the Idempotency-Key header is ignored.
+func NewHandler(svc *Service, idem IdempotencyStore) *Handler {
+	return &Handler{svc: svc, idem: idem}
 }
 
-// CreateUser handles POST /users.
-func (h *Handler) CreateUser(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	reqCtx := req.RequestContext
-	requestID := reqCtx.RequestID
-	requesterSub := extractSub(reqCtx)
-	if requesterSub == "" {
-		slog.Warn("missing JWT claims", "requestId", requestID)
-		return httpapi.ErrorResponse(401, "unauthorized"), nil
-	}
-	slog.Info("incoming request", "method", "POST", "path", req.RawPath, "requestId", requestID, "requesterSub", requesterSub)
+// CreateUser handles POST /users, returning the user with its ETag. With an Idempotency-Key header, the key is claimed before the user
+// is created: a retry of the same request replays the original 201 response, a retry while the first
+// request is still running gets a retryable 409, and reusing the key for a different request returns 422.
+// Keys are scoped to the caller, so other callers may use the same key.
+func (h *Handler) CreateUser(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+	requesterSub := extractSub(req.RequestContext)
 
 	var in CreateUserInput
 	if err := json.Unmarshal([]byte(req.Body), &in); err != nil {
-		return httpapi.ErrorResponse(400, "invalid JSON body"), nil
+		return httpapi.Problem(errInvalidJSON, requestID), nil
+	}
+	goCtx := SetRequestID(ctx, requestID)
+
+	var claim *IdempotencyRecord
+	idemKey := ""
+	if h.idem != nil {
+		idemKey = headerValue(req.Headers, IdempotencyHeader)
+	}
+	if idemKey != "" {
+		if len(idemKey) > maxIdempotencyKeyLength {
+			return httpapi.Problem(errIdempotencyKeyTooLong, requestID), nil
+		}
+		// Hash the decoded input so formatting differences in the body do not count as a different request
+		canonical, err := json.Marshal(in)
+		if err != nil {
+			return errorResponse(requestID, "hash request", err), nil
+		}
+		claim = &IdempotencyRecord{
+			Key:          idemKey,
+			RequestHash:  hashRequest(canonical),
+			RequesterSub: requesterSub,
+			ExpiresAt:    time.Now().Add(idempotencyClaimTTL).Unix(),
+		}
+		if resp, ok := h.claimIdempotencyKey(goCtx, *claim); !ok {
+			return resp, nil
+		}
 	}
-	goCtx := SetRequestID(context.Background(), requestID)
+
 	u, err := h.svc.CreateUser(goCtx, in, requesterSub)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "validation: ") {
-			return httpapi.ErrorResponse(400, strings.TrimPrefix(err.Error(), "validation: ")), nil
-		}
-		// User already exists (DynamoDB conditional check or mock)
-		if errors.Is(err, ErrUserAlreadyExists) || isConditionalCheckErr(err) {
-			return httpapi.ErrorResponse(409, "user already exists"), nil
+		if claim != nil {
+			h.releaseIdempotencyKey(goCtx, *claim)
 		}
-		slog.Error("create user failed", "requestId", requestID, "error", err)
-		return httpapi.ErrorResponse(500, "internal server error"), nil
+		return errorResponse(requestID, "create user", err), nil
 	}
 	slog.Info("DynamoDB write result", "requestId", requestID, "userId", u.ID, "action", "Put")
-	return httpapi.JSON(201, u), nil
+	resp := userResponse(201, u)
+	if claim != nil {
+		claim.StatusCode = resp.StatusCode
+		claim.Body = resp.Body
+		claim.ETag = resp.Headers[ETagHeader]
+		claim.ExpiresAt = time.Now().Add(idempotencyTTL).Unix()
+		h.completeIdempotencyRecord(goCtx, *claim)
+	}
+	return resp, nil
+}
+
+// claimIdempotencyKey claims rec.Key for this request. When the key is already claimed it returns
+// ok false with the response to send instead: the replayed original response, 422 if the key was used
+// for a different request, or a retryable 409 while the original request is still running.
+func (h *Handler) claimIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (resp events.APIGatewayV2HTTPResponse, ok bool) {
+	requestID := getRequestID(ctx)
+	err := h.idem.Put(ctx, rec)
+	if err == nil {
+		return resp, true
+	}
+	if !errors.Is(err, ErrIdempotencyRecordExists) {
+		return errorResponse(requestID, "claim idempotency key", err), false
+	}
+	existing, err := h.idem.Get(ctx, rec.RequesterSub, rec.Key)
+	if err != nil {
+		return errorResponse(requestID, "idempotency lookup", err), false
+	}
+	if existing != nil && existing.RequestHash != rec.RequestHash {
+		return httpapi.Problem(errIdempotencyKeyReused, requestID), false
+	}
+	// A claim released or expired since Put is treated like one still running: the retry claims it again
+	if existing == nil || existing.InProgress() {
+		resp = httpapi.Problem(errIdempotencyRequestInProgress, requestID)
+		resp.Headers["Retry-After"] = "1"
+		return resp, false
+	}
+	slog.Info("idempotent replay", "requestId", requestID, "idempotencyKey", rec.Key)
+	resp = httpapi.RawJSON(existing.StatusCode, existing.Body)
+	if existing.ETag != "" {
+		resp.Headers[ETagHeader] = existing.ETag
+	}
+	resp.Headers["Idempotent-Replayed"] = "true"
+	return resp, false
+}
+
+// completeIdempotencyRecord stores the response for replay. Failures are logged only: the user was
+// created, and once the claim expires a retry gets the regular 409 instead of a replay.
+func (h *Handler) completeIdempotencyRecord(ctx context.Context, rec IdempotencyRecord) {
+	if err := h.idem.Complete(ctx, rec); err != nil {
+		slog.Warn("store idempotency record failed", "requestId", getRequestID(ctx), "idempotencyKey", rec.Key, "error", err)
+	}
 }
 
-// GetUser handles GET /users/{id}. Id is extracted from req.RawPath.
-func (h *Handler) GetUser(req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
-	reqCtx := req.RequestContext
-	requestID := reqCtx.RequestID
-	requesterSub := extractSub(reqCtx)
-	if requesterSub == "" {
-		slog.Warn("missing JWT claims", "requestId", requestID)
-		return httpapi.ErrorResponse(401, "unauthorized"), nil
+// releaseIdempotencyKey deletes the claim of a failed request so it can be retried with the same key.
+// Failures are logged only: the claim expires after idempotencyClaimTTL.
+func (h *Handler) releaseIdempotencyKey(ctx context.Context, claim IdempotencyRecord) {
+	if err := h.idem.Delete(ctx, claim.RequesterSub, claim.Key); err != nil {
+		slog.Warn("release idempotency key failed", "requestId", getRequestID(ctx), "idempotencyKey", claim.Key, "error", err)
 	}
-	slog.Info("incoming request", "method", "GET", "path", req.RawPath, "requestId", requestID, "requesterSub", requesterSub)
+}
+
+// GetUser handles GET /users/{id}.
+// Deleted users are 404 unless the query has includeDeleted=true.
+func (h *Handler) GetUser(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
 
-	id := extractIDFromPath(req.RawPath)
-	if id == "" {
-		return httpapi.ErrorResponse(404, "not found"), nil
+	id := req.PathParam("id")
+	var opts []GetOption
+	if req.QueryStringParameters["includeDeleted"] == "true" {
+		opts = append(opts, IncludeDeleted())
 	}
-	goCtx := SetRequestID(context.Background(), requestID)
-	u, err := h.svc.GetUser(goCtx, id)
+	goCtx := SetRequestID(ctx, requestID)
+	u, err := h.svc.GetUser(goCtx, id, opts...)
 	if err != nil {
-		slog.Error("get user failed", "requestId", requestID, "error", err)
-		return httpapi.ErrorResponse(500, "internal server error"), nil
+		return errorResponse(requestID, "get user", err), nil
 	}
 	if u == nil {
-		return httpapi.ErrorResponse(404, "not found"), nil
+		return httpapi.Problem(ErrUserNotFound, requestID), nil
 	}
 	slog.Info("DynamoDB read result", "requestId", requestID, "userId", u.ID, "action", "GetItem")
-	return httpapi.JSON(200, u), nil
+	if noneMatch(req.Headers, u) {
+		return notModified(u), nil
+	}
+	return userResponse(200, u), nil
 }
 
-func extractSub(ctx events.APIGatewayV2HTTPRequestContext) string {
-	if ctx.Authorizer == nil || ctx.Authorizer.JWT == nil || ctx.Authorizer.JWT.Claims == nil {
-		return ""
+// ListUsers handles GET /users?limit=&cursor=, returning {items, nextCursor}.
+// With ?email= it looks the user up by email instead and returns {items} with zero or one user.
+func (h *Handler) ListUsers(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+
+	if email, ok := req.QueryStringParameters["email"]; ok {
+		return h.findUserByEmail(ctx, requestID, email)
 	}
-	return ctx.Authorizer.JWT.Claims["sub"]
+
+	opts := ListOptions{Cursor: req.QueryStringParameters["cursor"]}
+	if raw := req.QueryStringParameters["limit"]; raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return httpapi.Problem(errInvalidLimit, requestID), nil
+		}
+		opts.Limit = limit
+	}
+	goCtx := SetRequestID(ctx, requestID)
+	page, err := h.svc.ListUsers(goCtx, opts)
+	if err != nil {
+		return errorResponse(requestID, "list users", err), nil
+	}
+	slog.Info("DynamoDB read result", "requestId", requestID, "count", len(page.Items), "action", "Query")
+	return httpapi.JSON(200, page), nil
 }
 
-func extractIDFromPath(rawPath string) string {
-	path := strings.TrimSuffix(rawPath, "/")
-	if !strings.HasPrefix(path, usersPathPrefix) {
-		return ""
+func (h *Handler) findUserByEmail(ctx context.Context, requestID, email string) (events.APIGatewayV2HTTPResponse, error) {
+	goCtx := SetRequestID(ctx, requestID)
+	u, err := h.svc.GetUserByEmail(goCtx, email)
+	if err != nil {
+		return errorResponse(requestID, "get user by email", err), nil
+	}
+	page := &UserPage{Items: []*User{}}
+	if u != nil {
+		page.Items = append(page.Items, u)
+	}
+	slog.Info("DynamoDB read result", "requestId", requestID, "count", len(page.Items), "action", "Query")
+	return httpapi.JSON(200, page), nil
+}
+
+// GetMe handles GET /users/me, returning the active user linked to the caller's sub.
+func (h *Handler) GetMe(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+	goCtx := SetRequestID(ctx, requestID)
+	u, err := h.resolveMe(goCtx, req)
+	if err != nil {
+		return errorResponse(requestID, "get me", err), nil
+	}
+	slog.Info("DynamoDB read result", "requestId", requestID, "userId", u.ID, "action", "Query")
+	if noneMatch(req.Headers, u) {
+		return notModified(u), nil
 	}
-	return strings.TrimPrefix(path, usersPathPrefix)
+	return userResponse(200, u), nil
 }
 
-func isConditionalCheckErr(err error) bool {
-	var ccf *types.ConditionalCheckFailedException
-	return errors.As(err, &ccf)
-}
\ No newline at end of file
+// UpdateMe handles PATCH /users/me like PATCH /users/{id} for the user linked to the caller's sub.
+func (h *Handler) UpdateMe(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	u, err := h.resolveMe(SetRequestID(ctx, req.RequestContext.RequestID), req)
+	if err != nil {
+		return errorResponse(req.RequestContext.RequestID, "resolve me", err), nil
+	}
+	return h.updateUser(ctx, req, u.ID)
+}
+
+// resolveMe returns the user linked to the caller's sub, or ErrUserNotFound.
+func (h *Handler) resolveMe(ctx context.Context, req *httpapi.Request) (*User, error) {
+	u, err := h.svc.GetUserBySubject(ctx, extractSub(req.RequestContext))
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, ErrUserNotFound
+	}
+	return u, nil
+}
+
+// UpdateUser handles PATCH /users/{id}. Only the fields present in the body are changed.
+// If-Match with the user's ETag (or "*") is required.
+func (h *Handler) UpdateUser(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	return h.updateUser(ctx, req, req.PathParam("id"))
+}
+
+func (h *Handler) updateUser(ctx context.Context, req *httpapi.Request, id string) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+	requesterSub := extractSub(req.RequestContext)
+
+	writeOpts, err := ifMatchOptions(req.Headers)
+	if err != nil {
+		return httpapi.Problem(err, requestID), nil
+	}
+	var in UpdateUserInput
+	if err := json.Unmarshal([]byte(req.Body), &in); err != nil {
+		return httpapi.Problem(errInvalidJSON, requestID), nil
+	}
+	goCtx := SetRequestID(ctx, requestID)
+	u, err := h.svc.UpdateUser(goCtx, id, in, requesterSub, writeOpts...)
+	if err != nil {
+		return errorResponse(requestID, "update user", err), nil
+	}
+	slog.Info("DynamoDB write result", "requestId", requestID, "userId", u.ID, "action", "UpdateItem")
+	return userResponse(200, u), nil
+}
+
+// DeleteUser handles DELETE /users/{id}. The user is soft-deleted. If-Match is required.
+func (h *Handler) DeleteUser(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+	requesterSub := extractSub(req.RequestContext)
+
+	writeOpts, err := ifMatchOptions(req.Headers)
+	if err != nil {
+		return httpapi.Problem(err, requestID), nil
+	}
+	id := req.PathParam("id")
+	goCtx := SetRequestID(ctx, requestID)
+	if err := h.svc.DeleteUser(goCtx, id, requesterSub, writeOpts...); err != nil {
+		return errorResponse(requestID, "delete user", err), nil
+	}
+	slog.Info("DynamoDB write result", "requestId", requestID, "userId", id, "action", "SoftDelete")
+	return httpapi.Empty(204), nil
+}
+
+// RestoreUser handles POST /users/{id}:restore, undoing a soft delete. If-Match is required.
+func (h *Handler) RestoreUser(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+	requestID := req.RequestContext.RequestID
+	requesterSub := extractSub(req.RequestContext)
+
+	writeOpts, err := ifMatchOptions(req.Headers)
+	if err != nil {
+		return httpapi.Problem(err, requestID), nil
+	}
+	id := req.PathParam("id")
+	goCtx := SetRequestID(ctx, requestID)
+	u, err := h.svc.RestoreUser(goCtx, id, requesterSub, writeOpts...)
+	if err != nil {
+		return errorResponse(requestID, "restore user", err), nil
+	}
+	slog.Info("DynamoDB write result", "requestId", requestID, "userId", u.ID, "action", "Restore")
+	return userResponse(200, u), nil
+}
+
+var (
+	errInvalidJSON           = apperr.Validation("invalid_json", "invalid JSON body")
+	errIdempotencyKeyTooLong = apperr.Validation("idempotency_key_too_long", "Idempotency-Key is too long",
+		apperr.FieldError{Field: IdempotencyHeader, Code: "too_long", Message: "Idempotency-Key must be at most " + strconv.Itoa(maxIdempotencyKeyLength) + " characters"})
+	errIdempotencyKeyReused         = apperr.Unprocessable("idempotency_key_reused", "Idempotency-Key was already used for a different request")
+	errIdempotencyRequestInProgress = apperr.Conflict("idempotency_request_in_progress", "a request with this Idempotency-Key is still in progress; retry later")
+)
+
+// errorResponse maps err to a problem+json response with httpapi.Problem. Untyped errors are
+// unexpected failures: they are logged as "<op> failed" and returned as an opaque 500.
+func errorResponse(requestID, op string, err error) events.APIGatewayV2HTTPResponse {
+	if _, ok := apperr.As(err); !ok {
+		slog.Error(op+" failed", "requestId", requestID, "error", err)
+	}
+	return httpapi.Problem(err, requestID)
+}
+
+// headerValue returns the header value matching name case-insensitively
+// (API Gateway HTTP APIs lowercase header names).
+func headerValue(headers map[string]string, name string) string {
+	if v, ok := headers[strings.ToLower(name)]; ok {
+		return v
+	}
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func extractSub(ctx events.APIGatewayV2HTTPRequestContext) string {
+	if ctx.Authorizer == nil || ctx.Authorizer.JWT == nil || ctx.Authorizer.JWT.Claims == nil {
+		return ""
+	}
+	return ctx.Authorizer.JWT.Claims["sub"]
+}
@@ -0,0 +1,215 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+)
+
+// postUser is a POST /users by a users:write caller with sub, sending idemKey as the Idempotency-Key if set.
+func postUser(sub, body, idemKey string) apiRequest {
+	r := apiRequest{method: "POST", path: "/users", body: body, claims: map[string]string{"sub": sub, "scope": ScopeWrite}}
+	if idemKey != "" {
+		r.headers = map[string]string{IdempotencyHeader: idemKey}
+	}
+	return r
+}
+
+func TestHandler_CreateUser_IdempotencyKey(t *testing.T) {
+	api := newTestAPI(t)
+	body := `{"id":"u1","email":"a@b.com","name":"Alice"}`
+
+	first := api.do(postUser("sub-1", body, "key-1"))
+	if first.StatusCode != 201 || first.Headers["ETag"] != `"1"` {
+		t.Fatalf("first create: status %d, headers %v", first.StatusCode, first.Headers)
+	}
+
+	// Retry with the same key and an equivalent body replays the original response
+	replay := api.do(postUser("sub-1", `{"name":"Alice", "email":"a@b.com", "id":"u1"}`, "key-1"))
+	if replay.StatusCode != 201 {
+		t.Fatalf("replay: status %d, body %s", replay.StatusCode, replay.Body)
+	}
+	if replay.Body != first.Body {
+		t.Errorf("replay body differs:\n got %s\nwant %s", replay.Body, first.Body)
+	}
+	if replay.Headers["Idempotent-Replayed"] != "true" || replay.Headers["ETag"] != first.Headers["ETag"] {
+		t.Errorf("expected Idempotent-Replayed and the original ETag on replay, got %v", replay.Headers)
+	}
+	if len(api.pub.Published) != 1 {
+		t.Errorf("replay must not publish again, got %d events", len(api.pub.Published))
+	}
+
+	// Same key, different body
+	if resp := api.do(postUser("sub-1", `{"id":"u2","email":"c@d.com","name":"Bob"}`, "key-1")); resp.StatusCode != 422 {
+		t.Errorf("expected 422 for key reuse with different body, got %d", resp.StatusCode)
+	}
+	// Keys are per caller: another caller's key-1 is a separate request
+	if resp := api.do(postUser("sub-2", `{"id":"u2","email":"c@d.com","name":"Bob"}`, "key-1")); resp.StatusCode != 201 || resp.Headers["Idempotent-Replayed"] != "" {
+		t.Errorf("expected 201 for the same key from another caller, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	// Without a key, a retry is a plain conflict
+	if resp := api.do(postUser("sub-1", body, "")); resp.StatusCode != 409 {
+		t.Errorf("expected 409 without idempotency key, got %d", resp.StatusCode)
+	}
+
+	var u User
+	if err := json.Unmarshal([]byte(replay.Body), &u); err != nil || u.ID != "u1" {
+		t.Errorf("unexpected replay body %s: %v", replay.Body, err)
+	}
+}
+
+func TestHandler_CreateUser_IdempotencyClaim(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	body := `{"id":"u1","email":"a@b.com","name":"Alice"}`
+
+	// A failed create releases the claim, so the corrected request can reuse the key
+	if resp := api.do(postUser("sub-1", `{"id":"u1","email":"nope","name":"Alice"}`, "key-1")); resp.StatusCode != 400 {
+		t.Fatalf("invalid create: status %d", resp.StatusCode)
+	}
+	if resp := api.do(postUser("sub-1", body, "key-1")); resp.StatusCode != 201 {
+		t.Fatalf("create after failure: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+
+	// A retry while the first request still holds the claim is told to retry later
+	canonical, _ := json.Marshal(CreateUserInput{ID: "u2", Email: "c@d.com", Name: "Carol"})
+	claim := IdempotencyRecord{Key: "key-2", RequestHash: hashRequest(canonical), RequesterSub: "sub-1", ExpiresAt: time.Now().Add(time.Minute).Unix()}
+	if err := api.idem.Put(ctx, claim); err != nil {
+		t.Fatal(err)
+	}
+	resp := api.do(postUser("sub-1", `{"id":"u2","email":"c@d.com","name":"Carol"}`, "key-2"))
+	if resp.StatusCode != 409 || resp.Headers["Retry-After"] == "" || !strings.Contains(resp.Body, `"code":"idempotency_request_in_progress"`) {
+		t.Errorf("in progress: status %d, headers %v, body %s", resp.StatusCode, resp.Headers, resp.Body)
+	}
+	if rec, _ := api.idem.Get(ctx, "sub-1", "key-2"); rec == nil || !rec.InProgress() {
+		t.Errorf("the retry must not touch the claim, got %+v", rec)
+	}
+
+	// Store errors on the claim fail the request before the user is created
+	api.idem.PutError = errors.New("throttled")
+	if resp := api.do(postUser("sub-1", `{"id":"u3","email":"e@f.com","name":"Eve"}`, "key-3")); resp.StatusCode != 500 {
+		t.Errorf("claim error: status %d, want 500", resp.StatusCode)
+	}
+	api.idem.PutError = nil
+	if resp := api.do(postUser("sub-1", `{"id":"u3","email":"e@f.com","name":"Eve"}`, "key-3")); resp.StatusCode != 201 {
+		t.Errorf("create after claim error: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestHandler_CreateUser_ProblemDetails(t *testing.T) {
+	api := newTestAPI(t)
+
+	resp := api.do(postUser("sub-1", `{"id":"u1","email":"nope"}`, ""))
+	if resp.StatusCode != 400 || resp.Headers["Content-Type"] != "application/problem+json" {
+		t.Fatalf("status %d, headers %v", resp.StatusCode, resp.Headers)
+	}
+	var p httpapi.ProblemDetails
+	if err := json.Unmarshal([]byte(resp.Body), &p); err != nil {
+		t.Fatalf("decode %s: %v", resp.Body, err)
+	}
+	if p.Code != "validation_failed" || p.Instance != "req-test" || len(p.Errors) != 2 {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	if p.Errors[0].Field != "email" || p.Errors[0].Code != "invalid_format" || p.Errors[1].Field != "name" {
+		t.Errorf("unexpected field errors %+v", p.Errors)
+	}
+
+	if resp := api.do(postUser("sub-1", `{`, "")); resp.StatusCode != 400 || !strings.Contains(resp.Body, `"code":"invalid_json"`) {
+		t.Errorf("invalid JSON: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	api.do(postUser("sub-1", `{"id":"u1","email":"a@b.com","name":"A"}`, ""))
+	resp = api.do(postUser("sub-1", `{"id":"u1","email":"c@d.com","name":"C"}`, ""))
+	if resp.StatusCode != 409 || !strings.Contains(resp.Body, `"code":"user_already_exists"`) {
+		t.Errorf("duplicate: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestRouter_Me(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	if _, err := api.svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice", Subject: "sub-alice"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	me := func(method, sub, body string, headers map[string]string) apiRequest {
+		return apiRequest{method: method, path: "/users/me", body: body, claims: map[string]string{"sub": sub}, headers: headers}
+	}
+
+	resp := api.do(me("GET", "sub-alice", "", nil))
+	var u User
+	api.expect(resp, 200, &u)
+	if u.ID != "u1" || u.Subject != "sub-alice" {
+		t.Fatalf("GET /users/me: %+v", u)
+	}
+	if resp := api.do(me("PATCH", "sub-alice", `{"name":"Alicia"}`, map[string]string{"If-Match": resp.Headers["ETag"]})); resp.StatusCode != 200 || !strings.Contains(resp.Body, `"name":"Alicia"`) {
+		t.Errorf("PATCH /users/me: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	if resp := api.do(me("GET", "sub-nobody", "", nil)); resp.StatusCode != 404 {
+		t.Errorf("unlinked caller: status %d, want 404", resp.StatusCode)
+	}
+
+	_, err := api.svc.CreateUser(ctx, CreateUserInput{ID: "u2", Email: "c@d.com", Name: "Carol", Subject: "sub-alice"}, "admin")
+	if !errors.Is(err, ErrSubjectInUse) {
+		t.Errorf("expected ErrSubjectInUse, got %v", err)
+	}
+	_, err = api.svc.CreateUser(ctx, CreateUserInput{ID: "me", Email: "e@f.com", Name: "Me"}, "admin")
+	if err == nil || err.Error() != `validation: id must not be "me"` {
+		t.Errorf("expected reserved id error, got %v", err)
+	}
+}
+
+func TestHandler_ConditionalRequests(t *testing.T) {
+	api := newTestAPI(t)
+	if _, err := api.svc.CreateUser(context.Background(), CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, path, body string, headers ...string) apiRequest {
+		r := apiRequest{method: method, path: path, body: body, claims: adminClaims, headers: map[string]string{}}
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.headers[headers[i]] = headers[i+1]
+		}
+		return r
+	}
+
+	resp := api.do(request("GET", "/users/u1", ""))
+	if resp.StatusCode != 200 || resp.Headers["ETag"] != `"1"` {
+		t.Fatalf("GET: status %d, headers %v", resp.StatusCode, resp.Headers)
+	}
+	if resp := api.do(request("GET", "/users/u1", "", "If-None-Match", `W/"1"`)); resp.StatusCode != 304 || resp.Body != "" || resp.Headers["ETag"] != `"1"` {
+		t.Errorf("If-None-Match current: status %d, headers %v", resp.StatusCode, resp.Headers)
+	}
+	if resp := api.do(request("GET", "/users/u1", "", "If-None-Match", `"7"`)); resp.StatusCode != 200 {
+		t.Errorf("If-None-Match stale: status %d, want 200", resp.StatusCode)
+	}
+
+	if resp := api.do(request("PATCH", "/users/u1", `{"name":"Alicia"}`)); resp.StatusCode != 428 || !strings.Contains(resp.Body, `"code":"precondition_required"`) {
+		t.Errorf("missing If-Match: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	resp = api.do(request("PATCH", "/users/u1", `{"name":"Alicia"}`, "If-Match", `"1"`))
+	if resp.StatusCode != 200 || resp.Headers["ETag"] != `"2"` {
+		t.Fatalf("PATCH: status %d, headers %v, body %s", resp.StatusCode, resp.Headers, resp.Body)
+	}
+	for _, tag := range []string{`"1"`, `W/"2"`, "garbage"} {
+		if resp := api.do(request("PATCH", "/users/u1", `{"name":"Al"}`, "If-Match", tag)); resp.StatusCode != 412 || !strings.Contains(resp.Body, `"code":"version_mismatch"`) {
+			t.Errorf("If-Match %s: status %d, body %s", tag, resp.StatusCode, resp.Body)
+		}
+	}
+
+	if resp := api.do(request("DELETE", "/users/u1", "")); resp.StatusCode != 428 {
+		t.Errorf("DELETE without If-Match: status %d, want 428", resp.StatusCode)
+	}
+	if resp := api.do(request("DELETE", "/users/u1", "", "If-Match", `"1"`)); resp.StatusCode != 412 {
+		t.Errorf("DELETE stale: status %d, want 412", resp.StatusCode)
+	}
+	if resp := api.do(request("DELETE", "/users/u1", "", "If-Match", `"2"`)); resp.StatusCode != 204 {
+		t.Fatalf("DELETE: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	resp = api.do(request("POST", "/users/u1:restore", "", "If-Match", "*"))
+	if resp.StatusCode != 200 || resp.Headers["ETag"] != `"4"` {
+		t.Errorf("restore: status %d, headers %v, body %s", resp.StatusCode, resp.Headers, resp.Body)
+	}
+}
@@ -0,0 +1,60 @@
+package users
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// IdempotencyHeader is the request header clients set to make POST /users safe to retry.
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyTTL is how long a stored response can be replayed.
+const idempotencyTTL = 24 * time.Hour
+
+// idempotencyClaimTTL is how long a claim blocks the key while the request runs. It outlasts the
+// API Gateway integration timeout (30s), so a request that crashed does not block its retries for long.
+const idempotencyClaimTTL = time.Minute
+
+// maxIdempotencyKeyLength bounds the key so it fits comfortably in a DynamoDB key.
+const maxIdempotencyKeyLength = 255
+
+// ErrIdempotencyRecordExists is returned by IdempotencyStore.Put when the key is already claimed.
+var ErrIdempotencyRecordExists = errors.New("idempotency record already exists")
+
+// IdempotencyRecord is the stored outcome of a request made with an Idempotency-Key.
+type IdempotencyRecord struct {
+	Key          string
+	RequestHash  string // hashRequest of the request body
+	RequesterSub string // JWT sub of the original caller
+	StatusCode   int    // 0 while the request is in progress
+	Body         string // response body to replay
+	ETag         string // ETag header of the response, if any
+	ExpiresAt    int64  // unix seconds
+}
+
+// InProgress reports whether the request that claimed the key has not completed yet.
+func (r *IdempotencyRecord) InProgress() bool {
+	return r.StatusCode == 0
+}
+
+// IdempotencyStore persists idempotency records. Records are keyed by tenant, requester and key, so
+// callers that happen to pick the same key do not see each other's records.
+type IdempotencyStore interface {
+	// Get returns the live record for requesterSub's key, or nil if none.
+	Get(ctx context.Context, requesterSub, key string) (*IdempotencyRecord, error)
+	// Put claims rec.Key by storing rec unless a live record with the same key exists (ErrIdempotencyRecordExists).
+	Put(ctx context.Context, rec IdempotencyRecord) error
+	// Complete stores the response of a claimed record, replacing the claim made by Put with the same request hash.
+	Complete(ctx context.Context, rec IdempotencyRecord) error
+	// Delete releases the claim on requesterSub's key so the request can be retried. Completed records are kept.
+	Delete(ctx context.Context, requesterSub, key string) error
+}
+
+// hashRequest returns a hex SHA-256 of the request payload, used to detect a key reused for a different request.
+func hashRequest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
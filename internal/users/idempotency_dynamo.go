@@ -0,0 +1,162 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	idempotencyPKPrefix = "IDEMPOTENCY#"
+	idempotencySKPrefix = "SUB#"
+)
+
+// DynamoIdempotencyStore implements IdempotencyStore with DynamoDB. Records (pk IDEMPOTENCY#<key>,
+// sk SUB#<requesterSub>) live in the users table and are removed by the table's TTL on expiresAt.
+type DynamoIdempotencyStore struct {
+	client    *dynamodb.Client
+	tableName string
+}
+
+// NewDynamoIdempotencyStore returns a DynamoIdempotencyStore.
+func NewDynamoIdempotencyStore(client *dynamodb.Client, tableName string) *DynamoIdempotencyStore {
+	return &DynamoIdempotencyStore{client: client, tableName: tableName}
+}
+
+// dynamoIdempotency is the stored item shape.
+type dynamoIdempotency struct {
+	PK           string `dynamodbav:"pk"`
+	SK           string `dynamodbav:"sk"`
+	Key          string `dynamodbav:"idempotencyKey"`
+	RequestHash  string `dynamodbav:"requestHash"`
+	RequesterSub string `dynamodbav:"requesterSub"`
+	StatusCode   int    `dynamodbav:"statusCode"`
+	Body         string `dynamodbav:"body"`
+	ETag         string `dynamodbav:"etag,omitempty"`
+	ExpiresAt    int64  `dynamodbav:"expiresAt"`
+}
+
+// idempotencyKey is the item key of requesterSub's key in the tenant from ctx, so neither tenants nor
+// callers sharing a key can replay each other's responses.
+func idempotencyKey(ctx context.Context, requesterSub, key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + idempotencyPKPrefix + key},
+		"sk": &types.AttributeValueMemberS{Value: idempotencySKPrefix + requesterSub},
+	}
+}
+
+// Get returns the record for requesterSub's key, or nil if none. TTL deletion is lazy, so expired items are filtered here.
+func (s *DynamoIdempotencyStore) Get(ctx context.Context, requesterSub, key string) (*IdempotencyRecord, error) {
+	out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &s.tableName,
+		Key:            idempotencyKey(ctx, requesterSub, key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.Item == nil {
+		return nil, nil
+	}
+	var item dynamoIdempotency
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		return nil, fmt.Errorf("unmarshal idempotency record: %w", err)
+	}
+	if item.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	return &IdempotencyRecord{
+		Key:          item.Key,
+		RequestHash:  item.RequestHash,
+		RequesterSub: item.RequesterSub,
+		StatusCode:   item.StatusCode,
+		Body:         item.Body,
+		ETag:         item.ETag,
+		ExpiresAt:    item.ExpiresAt,
+	}, nil
+}
+
+// idempotencyItem is the stored item for rec in the tenant from ctx.
+func idempotencyItem(ctx context.Context, rec IdempotencyRecord) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(dynamoIdempotency{
+		PK:           tenantPrefix(ctx) + idempotencyPKPrefix + rec.Key,
+		SK:           idempotencySKPrefix + rec.RequesterSub,
+		Key:          rec.Key,
+		RequestHash:  rec.RequestHash,
+		RequesterSub: rec.RequesterSub,
+		StatusCode:   rec.StatusCode,
+		Body:         rec.Body,
+		ETag:         rec.ETag,
+		ExpiresAt:    rec.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal idempotency record: %w", err)
+	}
+	return item, nil
+}
+
+// Put claims rec.Key unless a live record exists for the same key.
+func (s *DynamoIdempotencyStore) Put(ctx context.Context, rec IdempotencyRecord) error {
+	item, err := idempotencyItem(ctx, rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &s.tableName,
+		Item:                item,
+		ConditionExpression: ptr("attribute_not_exists(pk) OR expiresAt <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrIdempotencyRecordExists
+		}
+		return err
+	}
+	return nil
+}
+
+// Complete overwrites the claim with rec. The condition on the request hash keeps a claim that expired
+// and was taken by a different request from being overwritten.
+func (s *DynamoIdempotencyStore) Complete(ctx context.Context, rec IdempotencyRecord) error {
+	item, err := idempotencyItem(ctx, rec)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           &s.tableName,
+		Item:                item,
+		ConditionExpression: ptr("requestHash = :hash"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":hash": &types.AttributeValueMemberS{Value: rec.RequestHash},
+		},
+	})
+	return err
+}
+
+// Delete removes the claim on requesterSub's key. A completed record (statusCode set) is left in place.
+func (s *DynamoIdempotencyStore) Delete(ctx context.Context, requesterSub, key string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           &s.tableName,
+		Key:                 idempotencyKey(ctx, requesterSub, key),
+		ConditionExpression: ptr("statusCode = :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MockIdempotencyStore is an in-memory IdempotencyStore for tests. Expired records are ignored like
+// items past their DynamoDB TTL. Keys are scoped to the tenant in the context and the requester.
+type MockIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[mockIdempotencyKey]IdempotencyRecord
+
+	GetError      error // if set, Get returns (nil, this error)
+	PutError      error // if set, Put returns this error
+	CompleteError error // if set, Complete returns this error
+}
+
+type mockIdempotencyKey struct {
+	tenant, requesterSub, key string
+}
+
+func mockIdemKey(ctx context.Context, requesterSub, key string) mockIdempotencyKey {
+	return mockIdempotencyKey{tenant: tenantPrefix(ctx), requesterSub: requesterSub, key: key}
+}
+
+// NewMockIdempotencyStore returns a new MockIdempotencyStore (empty store).
+func NewMockIdempotencyStore() *MockIdempotencyStore {
+	return &MockIdempotencyStore{records: make(map[mockIdempotencyKey]IdempotencyRecord)}
+}
+
+// Get returns the record for requesterSub's key, or nil if none or expired.
+func (m *MockIdempotencyStore) Get(ctx context.Context, requesterSub, key string) (*IdempotencyRecord, error) {
+	if m.GetError != nil {
+		return nil, m.GetError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[mockIdemKey(ctx, requesterSub, key)]
+	if !ok || rec.ExpiresAt <= time.Now().Unix() {
+		return nil, nil
+	}
+	return &rec, nil
+}
+
+// Put claims rec.Key by storing rec. Returns ErrIdempotencyRecordExists if a live record with the same key exists.
+func (m *MockIdempotencyStore) Put(ctx context.Context, rec IdempotencyRecord) error {
+	if m.PutError != nil {
+		return m.PutError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := mockIdemKey(ctx, rec.RequesterSub, rec.Key)
+	if existing, ok := m.records[k]; ok && existing.ExpiresAt > time.Now().Unix() {
+		return ErrIdempotencyRecordExists
+	}
+	m.records[k] = rec
+	return nil
+}
+
+// Complete replaces the record for rec.Key with rec if it was claimed with the same request hash.
+func (m *MockIdempotencyStore) Complete(ctx context.Context, rec IdempotencyRecord) error {
+	if m.CompleteError != nil {
+		return m.CompleteError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := mockIdemKey(ctx, rec.RequesterSub, rec.Key)
+	if existing, ok := m.records[k]; !ok || existing.RequestHash != rec.RequestHash {
+		return errors.New("idempotency claim not found")
+	}
+	m.records[k] = rec
+	return nil
+}
+
+// Delete removes the record for requesterSub's key unless it was completed.
+func (m *MockIdempotencyStore) Delete(ctx context.Context, requesterSub, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := mockIdemKey(ctx, requesterSub, key)
+	if rec, ok := m.records[k]; ok && rec.InProgress() {
+		delete(m.records, k)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package users
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+// Request headers read by Correlate (lowercase, as API Gateway delivers them).
+const (
+	CorrelationIDHeader = "x-correlation-id"
+	TraceParentHeader   = "traceparent"
+)
+
+// SQS and SNS message attributes mirroring the envelope, so consumers can route, filter and dedupe
+// without parsing the body.
+const (
+	attrEventID       = "eventId"
+	attrEventType     = "eventType"
+	attrVersion       = "version"
+	attrTenantID      = "tenantId"
+	attrCorrelationID = "correlationId"
+	attrCausationID   = "causationId"
+	attrProducer      = "producer"
+	attrTraceParent   = "traceparent"
+)
+
+var (
+	// correlationIDRegex keeps caller-supplied correlation ids short and printable.
+	correlationIDRegex = regexp.MustCompile(`^[A-Za-z0-9._:/+=@-]{1,128}$`)
+	// traceParentRegex matches a W3C traceparent header (version, trace id, parent id, flags).
+	traceParentRegex = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+)
+
+// Correlate is a middleware that stores the event metadata of the request with WithEventMetadata:
+// the caller's X-Correlation-Id (or the request id when absent or invalid), the request id as the
+// cause of the events it publishes, and its traceparent header if valid.
+func Correlate() httpapi.Middleware {
+	return func(next httpapi.Handler) httpapi.Handler {
+		return func(ctx context.Context, req *httpapi.Request) (awsevents.APIGatewayV2HTTPResponse, error) {
+			requestID := req.RequestContext.RequestID
+			md := events.Metadata{CorrelationID: requestID, CausationID: requestID}
+			if id := req.Headers[CorrelationIDHeader]; correlationIDRegex.MatchString(id) {
+				md.CorrelationID = id
+			}
+			if tp := req.Headers[TraceParentHeader]; traceParentRegex.MatchString(tp) {
+				md.TraceParent = tp
+			}
+			return next(WithEventMetadata(ctx, md), req)
+		}
+	}
+}
+
+// WithEventMetadata stores the metadata of the events published with ctx. Empty fields are filled by
+// the publisher: a new event id, the request id as correlation and causation id, and its own producer.
+func WithEventMetadata(ctx context.Context, md events.Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey, md)
+}
+
+// eventMetadata returns the metadata for an event published with ctx by producer.
+func eventMetadata(ctx context.Context, producer string) (events.Metadata, error) {
+	md, _ := ctx.Value(metadataKey).(events.Metadata)
+	if md.EventID == "" {
+		id, err := events.NewEventID()
+		if err != nil {
+			return events.Metadata{}, err
+		}
+		md.EventID = id
+	}
+	if md.CorrelationID == "" {
+		md.CorrelationID = getRequestID(ctx)
+	}
+	if md.CausationID == "" {
+		md.CausationID = getRequestID(ctx)
+	}
+	md.Producer = producer
+	return md, nil
+}
+
+// withMetadata returns ev with the metadata for ctx and producer.
+func withMetadata(ctx context.Context, ev events.Envelope, producer string) (events.Envelope, error) {
+	md, err := eventMetadata(ctx, producer)
+	if err != nil {
+		return events.Envelope{}, err
+	}
+	ev.Metadata = md
+	return ev, nil
+}
+
+// envelopeAttributes returns the message attributes mirroring ev; empty values are left out.
+func envelopeAttributes(ev events.Envelope) map[string]string {
+	all := map[string]string{
+		attrEventID:       ev.EventID,
+		attrEventType:     ev.EventType,
+		attrVersion:       ev.Version,
+		attrTenantID:      ev.TenantID,
+		attrCorrelationID: ev.CorrelationID,
+		attrCausationID:   ev.CausationID,
+		attrProducer:      ev.Producer,
+		attrTraceParent:   ev.TraceParent,
+	}
+	attrs := make(map[string]string, len(all))
+	for k, v := range all {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
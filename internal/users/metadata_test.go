@@ -0,0 +1,42 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+func TestCorrelate(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    events.Metadata
+	}{
+		{"no headers", nil, events.Metadata{CorrelationID: "req-1", CausationID: "req-1"}},
+		{"caller ids", map[string]string{CorrelationIDHeader: "order-42", TraceParentHeader: traceParent}, events.Metadata{CorrelationID: "order-42", CausationID: "req-1", TraceParent: traceParent}},
+		{"invalid headers", map[string]string{CorrelationIDHeader: "has spaces", TraceParentHeader: "not-a-trace"}, events.Metadata{CorrelationID: "req-1", CausationID: "req-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got events.Metadata
+			h := Correlate()(func(ctx context.Context, req *httpapi.Request) (awsevents.APIGatewayV2HTTPResponse, error) {
+				got, _ = ctx.Value(metadataKey).(events.Metadata)
+				return awsevents.APIGatewayV2HTTPResponse{StatusCode: 200}, nil
+			})
+			req := &httpapi.Request{APIGatewayV2HTTPRequest: awsevents.APIGatewayV2HTTPRequest{
+				Headers:        tt.headers,
+				RequestContext: awsevents.APIGatewayV2HTTPRequestContext{RequestID: "req-1"},
+			}}
+			if _, err := h(context.Background(), req); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("metadata %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
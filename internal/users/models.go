@@ -5,13 +5,48 @@ type User struct {
 	ID        string `json:"id"`
 	Email     string `json:"email"`
 	Name      string `json:"name"`
-	CreatedAt string `json:"createdAt"` // ISO8601
-	CreatedBy string `json:"createdBy"` // JWT sub
+	Subject   string `json:"subject,omitempty"`   // JWT sub of the person this user represents, used by /users/me
+	CreatedAt string `json:"createdAt"`           // ISO8601
+	CreatedBy string `json:"createdBy"`           // JWT sub
+	UpdatedAt string `json:"updatedAt,omitempty"` // ISO8601, empty until the first update
+	UpdatedBy string `json:"updatedBy,omitempty"` // JWT sub of the last updater
+	DeletedAt string `json:"deletedAt,omitempty"` // ISO8601, set while the user is soft-deleted
+	DeletedBy string `json:"deletedBy,omitempty"` // JWT sub of the deleter
+	Version   int64  `json:"-"`                   // incremented by every write; returned as the ETag
 }
 
 // CreateUserInput is the request body for creating a user.
 type CreateUserInput struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID      string `json:"id"`
+	Email   string `json:"email"`
+	Name    string `json:"name"`
+	Subject string `json:"subject,omitempty"` // optional; links the user to a JWT sub
+}
+
+// UpdateUserInput is the request body for partially updating a user.
+// Nil fields are left unchanged.
+type UpdateUserInput struct {
+	Email *string `json:"email"`
+	Name  *string `json:"name"`
+}
+
+// UserUpdate is the set of changes applied by UserRepository.Update.
+// Nil fields are left unchanged; UpdatedAt and UpdatedBy are always written.
+type UserUpdate struct {
+	Email     *string
+	Name      *string
+	UpdatedAt string
+	UpdatedBy string
+}
+
+// ListOptions controls UserRepository.List paging.
+type ListOptions struct {
+	Limit  int    // maximum number of users in the page
+	Cursor string // opaque cursor from a previous page's NextCursor; empty for the first page
+}
+
+// UserPage is one page of users. NextCursor is empty when there are no more pages.
+type UserPage struct {
+	Items      []*User `json:"items"`
+	NextCursor string  `json:"nextCursor,omitempty"`
 }
@@ -0,0 +1,120 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// OutboxMessage is an event written in the same transaction as the state change that produced it.
+// It stays pending until a relay has handed it to the EventPublisher. ID becomes the event id, so
+// every delivery of the message carries the same id and consumers can dedupe redeliveries.
+type OutboxMessage struct {
+	ID            string
+	EventType     string
+	Payload       json.RawMessage // JSON-encoded event payload, e.g. UserCreatedEventPayload
+	CreatedAt     string          // ISO8601
+	CorrelationID string          // event metadata of the request that wrote the message
+	CausationID   string
+	TraceParent   string
+}
+
+// OutboxStore reads and acknowledges pending outbox messages.
+type OutboxStore interface {
+	ListPendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, id string) error
+}
+
+// newOutboxMessage encodes payload into a pending outbox message with a new event id and the event
+// metadata of ctx.
+func newOutboxMessage(ctx context.Context, eventType string, payload interface{}, createdAt string) (OutboxMessage, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return OutboxMessage{}, fmt.Errorf("marshal outbox payload: %w", err)
+	}
+	md, err := eventMetadata(ctx, "")
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+	return OutboxMessage{
+		ID:            md.EventID,
+		EventType:     eventType,
+		Payload:       raw,
+		CreatedAt:     createdAt,
+		CorrelationID: md.CorrelationID,
+		CausationID:   md.CausationID,
+		TraceParent:   md.TraceParent,
+	}, nil
+}
+
+// OutboxRelay delivers outbox messages to an EventPublisher and marks them sent.
+// A message is marked sent only after a successful publish, so delivery is at-least-once:
+// if marking fails the message is published again by a later sweep.
+type OutboxRelay struct {
+	store     OutboxStore
+	publisher EventPublisher
+}
+
+// NewOutboxRelay returns a new OutboxRelay.
+func NewOutboxRelay(store OutboxStore, publisher EventPublisher) *OutboxRelay {
+	return &OutboxRelay{store: store, publisher: publisher}
+}
+
+// Deliver publishes a single message and marks it sent.
+func (r *OutboxRelay) Deliver(ctx context.Context, msg OutboxMessage) error {
+	if err := r.publish(ctx, msg); err != nil {
+		return err
+	}
+	if err := r.store.MarkOutboxSent(ctx, msg.ID); err != nil {
+		return fmt.Errorf("mark outbox %s sent: %w", msg.ID, err)
+	}
+	return nil
+}
+
+// Sweep delivers up to limit pending messages, oldest first. It keeps going after a failed message
+// and returns the number delivered together with the first error.
+func (r *OutboxRelay) Sweep(ctx context.Context, limit int) (int, error) {
+	msgs, err := r.store.ListPendingOutbox(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("list pending outbox: %w", err)
+	}
+	delivered := 0
+	var firstErr error
+	for _, msg := range msgs {
+		if err := r.Deliver(ctx, msg); err != nil {
+			slog.Error("outbox delivery failed", "outboxId", msg.ID, "eventType", msg.EventType, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delivered++
+	}
+	slog.Info("outbox sweep finished", "pending", len(msgs), "delivered", delivered)
+	return delivered, firstErr
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, msg OutboxMessage) error {
+	ctx = WithEventMetadata(ctx, events.Metadata{
+		EventID:       msg.ID,
+		CorrelationID: msg.CorrelationID,
+		CausationID:   msg.CausationID,
+		TraceParent:   msg.TraceParent,
+	})
+	switch msg.EventType {
+	case events.UserCreatedEventType:
+		var p UserCreatedEventPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			return fmt.Errorf("unmarshal outbox payload: %w", err)
+		}
+		if p.CreatedAt == "" {
+			p.CreatedAt = msg.CreatedAt
+		}
+		return r.publisher.PublishUserCreated(ctx, p)
+	default:
+		return fmt.Errorf("outbox: unsupported event type %q", msg.EventType)
+	}
+}
@@ -0,0 +1,147 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Event backends accepted in PublisherConfig.Backend.
+const (
+	BackendSQS         = "sqs"
+	BackendEventBridge = "eventbridge"
+	BackendSNS         = "sns"
+)
+
+// DefaultEventSource is the source (EventBridge source, CloudEvents source and envelope producer) of user
+// events when PublisherConfig.Source is empty.
+const DefaultEventSource = "serverless-user-service"
+
+// PublisherConfig selects where user events are published. Only the target of the chosen backend is used.
+type PublisherConfig struct {
+	Backend      string        // BackendSQS (the default when empty), BackendEventBridge or BackendSNS
+	QueueURL     string        // SQS queue URL
+	Format       MessageFormat // SQS message format; FormatEnvelope if empty
+	EventBusName string        // EventBridge bus name or ARN
+	Source       string        // event source and producer for every backend; DefaultEventSource if empty
+	TopicARN     string        // SNS topic ARN
+}
+
+// PublisherConfigFromEnv reads a PublisherConfig from EVENTS_BACKEND, EVENTS_QUEUE_URL, EVENTS_FORMAT,
+// EVENT_BUS_NAME, EVENT_SOURCE and EVENTS_TOPIC_ARN using getenv (e.g. os.Getenv).
+func PublisherConfigFromEnv(getenv func(string) string) PublisherConfig {
+	return PublisherConfig{
+		Backend:      getenv("EVENTS_BACKEND"),
+		QueueURL:     getenv("EVENTS_QUEUE_URL"),
+		Format:       MessageFormat(getenv("EVENTS_FORMAT")),
+		EventBusName: getenv("EVENT_BUS_NAME"),
+		Source:       getenv("EVENT_SOURCE"),
+		TopicARN:     getenv("EVENTS_TOPIC_ARN"),
+	}
+}
+
+// NewEventPublisher returns the EventPublisher for pc.Backend, with clients built from cfg.
+func NewEventPublisher(cfg aws.Config, pc PublisherConfig) (EventPublisher, error) {
+	source := pc.Source
+	if source == "" {
+		source = DefaultEventSource
+	}
+	isSQS := pc.Backend == "" || pc.Backend == BackendSQS
+	if pc.Format != "" && !isSQS {
+		return nil, fmt.Errorf("message format %q is only supported by the %s event backend", pc.Format, BackendSQS)
+	}
+	switch pc.Backend {
+	case "", BackendSQS:
+		if pc.QueueURL == "" {
+			return nil, errors.New("sqs event backend needs a queue URL")
+		}
+		format := pc.Format
+		switch format {
+		case "":
+			format = FormatEnvelope
+		case FormatEnvelope, FormatCloudEvents, FormatCloudEventsBinary:
+		default:
+			return nil, fmt.Errorf("unknown message format %q (want %s, %s or %s)", format, FormatEnvelope, FormatCloudEvents, FormatCloudEventsBinary)
+		}
+		return NewSQSPublisher(sqs.NewFromConfig(cfg), pc.QueueURL, WithMessageFormat(format, source)), nil
+	case BackendEventBridge:
+		if pc.EventBusName == "" {
+			return nil, errors.New("eventbridge event backend needs an event bus name")
+		}
+		return NewEventBridgePublisher(eventbridge.NewFromConfig(cfg), pc.EventBusName, source), nil
+	case BackendSNS:
+		if pc.TopicARN == "" {
+			return nil, errors.New("sns event backend needs a topic ARN")
+		}
+		return NewSNSPublisher(sns.NewFromConfig(cfg), pc.TopicARN, source), nil
+	default:
+		return nil, fmt.Errorf("unknown event backend %q (want %s, %s or %s)", pc.Backend, BackendSQS, BackendEventBridge, BackendSNS)
+	}
+}
+
+// The envelope builders below are shared by every EventPublisher backend. An event occurred when its
+// change was written, not when it is published, so occurredAt is the payload's write timestamp; a
+// relay may publish long after the write.
+
+// occurredAt returns at, or the current time for a payload without a write timestamp.
+func occurredAt(at string) string {
+	if at == "" {
+		return time.Now().UTC().Format(time.RFC3339)
+	}
+	return at
+}
+
+func userCreatedEnvelope(payload UserCreatedEventPayload) events.Envelope {
+	ev := events.NewUserCreatedEnvelope(occurredAt(payload.CreatedAt), events.UserCreatedV1{
+		UserID:    payload.UserID,
+		Email:     payload.Email,
+		Name:      payload.Name,
+		CreatedAt: payload.CreatedAt,
+		CreatedBy: payload.CreatedBy,
+		RequestID: payload.RequestID,
+	})
+	ev.TenantID = payload.TenantID
+	return ev
+}
+
+func userUpdatedEnvelope(payload UserUpdatedEventPayload) events.Envelope {
+	ev := events.NewUserUpdatedEnvelope(occurredAt(payload.UpdatedAt), events.UserUpdatedV1{
+		UserID:        payload.UserID,
+		Email:         payload.Email,
+		Name:          payload.Name,
+		ChangedFields: payload.ChangedFields,
+		UpdatedAt:     payload.UpdatedAt,
+		UpdatedBy:     payload.UpdatedBy,
+		RequestID:     payload.RequestID,
+	})
+	ev.TenantID = payload.TenantID
+	return ev
+}
+
+func userDeletedEnvelope(payload UserDeletedEventPayload) events.Envelope {
+	ev := events.NewUserDeletedEnvelope(occurredAt(payload.DeletedAt), events.UserDeletedV1{
+		UserID:    payload.UserID,
+		DeletedAt: payload.DeletedAt,
+		DeletedBy: payload.DeletedBy,
+		RequestID: payload.RequestID,
+	})
+	ev.TenantID = payload.TenantID
+	return ev
+}
+
+func userRestoredEnvelope(payload UserRestoredEventPayload) events.Envelope {
+	ev := events.NewUserRestoredEnvelope(occurredAt(payload.RestoredAt), events.UserRestoredV1{
+		UserID:     payload.UserID,
+		RestoredAt: payload.RestoredAt,
+		RestoredBy: payload.RestoredBy,
+		RequestID:  payload.RequestID,
+	})
+	ev.TenantID = payload.TenantID
+	return ev
+}
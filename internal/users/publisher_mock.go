@@ -7,10 +7,13 @@ import (
 
 // MockPublisher is an in-memory EventPublisher for tests. It records published payloads.
 type MockPublisher struct {
-	mu       sync.Mutex
+	mu        sync.Mutex
 	Published []UserCreatedEventPayload
+	Updated   []UserUpdatedEventPayload
+	Deleted   []UserDeletedEventPayload
+	Restored  []UserRestoredEventPayload
 
-	// PublishError, if set, makes PublishUserCreated return this error (e.g. to test SQS failure path).
+	// PublishError, if set, makes every Publish* method return this error (e.g. to test SQS failure path).
 	PublishError error
 }
 
@@ -26,3 +29,27 @@ func (m *MockPublisher) PublishUserCreated(ctx context.Context, payload UserCrea
 	m.Published = append(m.Published, payload)
 	return m.PublishError
 }
+
+// PublishUserUpdated appends the payload to Updated and returns PublishError if set.
+func (m *MockPublisher) PublishUserUpdated(ctx context.Context, payload UserUpdatedEventPayload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Updated = append(m.Updated, payload)
+	return m.PublishError
+}
+
+// PublishUserDeleted appends the payload to Deleted and returns PublishError if set.
+func (m *MockPublisher) PublishUserDeleted(ctx context.Context, payload UserDeletedEventPayload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Deleted = append(m.Deleted, payload)
+	return m.PublishError
+}
+
+// PublishUserRestored appends the payload to Restored and returns PublishError if set.
+func (m *MockPublisher) PublishUserRestored(ctx context.Context, payload UserRestoredEventPayload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Restored = append(m.Restored, payload)
+	return m.PublishError
+}
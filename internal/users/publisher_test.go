@@ -0,0 +1,255 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// The fake clients record the requests a publisher makes and return err.
+
+type fakeSQS struct {
+	inputs []*sqs.SendMessageInput
+	err    error
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sqs.SendMessageOutput{}, f.err
+}
+
+type fakeEventBridge struct {
+	inputs []*eventbridge.PutEventsInput
+	out    eventbridge.PutEventsOutput
+	err    error
+}
+
+func (f *fakeEventBridge) PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, _ ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &f.out, f.err
+}
+
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+	err    error
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, in *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sns.PublishOutput{}, f.err
+}
+
+var testUpdatedPayload = UserUpdatedEventPayload{UserID: "u1", Name: "Alicia", ChangedFields: []string{"name"}, UpdatedAt: "2024-01-02T00:00:00Z", UpdatedBy: "admin", TenantID: "acme"}
+
+// checkEnvelope decodes body and checks it is the user.updated envelope for testUpdatedPayload.
+func checkEnvelope(t *testing.T, body string) {
+	t.Helper()
+	env, err := events.DecodeEnvelope([]byte(body))
+	if err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+	var p events.UserUpdatedV1
+	if err := env.DecodePayload(&p); err != nil {
+		t.Fatal(err)
+	}
+	if env.EventType != events.UserUpdatedEventType || env.TenantID != "acme" || p.UserID != "u1" || p.Name != "Alicia" {
+		t.Errorf("unexpected envelope %+v with payload %+v", env, p)
+	}
+	// The event occurred at the write, not at publish time
+	if env.OccurredAt != testUpdatedPayload.UpdatedAt {
+		t.Errorf("occurredAt %s, want %s", env.OccurredAt, testUpdatedPayload.UpdatedAt)
+	}
+}
+
+func TestSQSPublisher_Request(t *testing.T) {
+	client := &fakeSQS{}
+	if err := NewSQSPublisher(client, "https://sqs.example/queue").PublishUserUpdated(context.Background(), testUpdatedPayload); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.inputs) != 1 || aws.ToString(client.inputs[0].QueueUrl) != "https://sqs.example/queue" {
+		t.Fatalf("unexpected requests %+v", client.inputs)
+	}
+	checkEnvelope(t, aws.ToString(client.inputs[0].MessageBody))
+}
+
+func TestSQSPublisher_Metadata(t *testing.T) {
+	client := &fakeSQS{}
+	ctx := SetRequestID(context.Background(), "req-1")
+	ctx = WithEventMetadata(ctx, events.Metadata{CorrelationID: "corr-1", TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	pub := NewSQSPublisher(client, "q", WithMessageFormat(FormatEnvelope, "my.source"))
+	for i := 0; i < 2; i++ {
+		if err := pub.PublishUserUpdated(ctx, testUpdatedPayload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env, err := events.DecodeEnvelope([]byte(aws.ToString(client.inputs[0].MessageBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := events.Metadata{
+		EventID:       env.EventID,
+		CorrelationID: "corr-1",
+		CausationID:   "req-1", // the request id, as the context sets no cause
+		Producer:      "my.source",
+		TraceParent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	if env.EventID == "" || env.Metadata != want {
+		t.Errorf("metadata %+v, want %+v", env.Metadata, want)
+	}
+	second, _ := events.DecodeEnvelope([]byte(aws.ToString(client.inputs[1].MessageBody)))
+	if second.EventID == env.EventID {
+		t.Error("each publish needs a new event id")
+	}
+
+	// The metadata is mirrored into message attributes
+	attrs := client.inputs[0].MessageAttributes
+	for name, v := range map[string]string{"eventId": want.EventID, "eventType": "user.updated", "version": "1", "tenantId": "acme", "correlationId": "corr-1", "causationId": "req-1", "producer": "my.source", "traceparent": want.TraceParent} {
+		if a := attrs[name]; aws.ToString(a.DataType) != "String" || aws.ToString(a.StringValue) != v {
+			t.Errorf("attribute %s = %s %q, want String %q", name, aws.ToString(a.DataType), aws.ToString(a.StringValue), v)
+		}
+	}
+	if len(attrs) != 8 {
+		t.Errorf("%d attributes, want 8: %v", len(attrs), attrs)
+	}
+}
+
+func TestSQSPublisher_CloudEvents(t *testing.T) {
+	client := &fakeSQS{}
+	ctx := context.Background()
+	if err := NewSQSPublisher(client, "q", WithMessageFormat(FormatCloudEvents, "my.source")).PublishUserUpdated(ctx, testUpdatedPayload); err != nil {
+		t.Fatal(err)
+	}
+	var ce events.CloudEvent
+	if err := json.Unmarshal([]byte(aws.ToString(client.inputs[0].MessageBody)), &ce); err != nil {
+		t.Fatal(err)
+	}
+	if ce.SpecVersion != "1.0" || ce.Source != "my.source" || ce.Type != "user.updated" || ce.ID == "" || len(client.inputs[0].MessageAttributes) != 0 {
+		t.Errorf("unexpected structured event %+v", ce)
+	}
+	checkEnvelope(t, aws.ToString(client.inputs[0].MessageBody))
+
+	if err := NewSQSPublisher(client, "q", WithMessageFormat(FormatCloudEventsBinary, "my.source")).PublishUserUpdated(ctx, testUpdatedPayload); err != nil {
+		t.Fatal(err)
+	}
+	in := client.inputs[1]
+	attrs := make(map[string]string)
+	for name, a := range in.MessageAttributes {
+		if aws.ToString(a.DataType) != "String" {
+			t.Errorf("attribute %s has type %s", name, aws.ToString(a.DataType))
+		}
+		attrs[name] = aws.ToString(a.StringValue)
+	}
+	if attrs["ce-type"] != "user.updated" || attrs["ce-source"] != "my.source" || attrs["ce-tenantid"] != "acme" || len(attrs) > 10 {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	env, err := events.DecodeBinaryCloudEvent(attrs, []byte(aws.ToString(in.MessageBody)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p events.UserUpdatedV1
+	if err := env.DecodePayload(&p); err != nil || p.Name != "Alicia" {
+		t.Errorf("binary body %s: %+v, %v", aws.ToString(in.MessageBody), p, err)
+	}
+}
+
+func TestEventBridgePublisher_Request(t *testing.T) {
+	client := &fakeEventBridge{}
+	if err := NewEventBridgePublisher(client, "users-bus", "my.source").PublishUserUpdated(context.Background(), testUpdatedPayload); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.inputs) != 1 || len(client.inputs[0].Entries) != 1 {
+		t.Fatalf("unexpected requests %+v", client.inputs)
+	}
+	e := client.inputs[0].Entries[0]
+	if aws.ToString(e.EventBusName) != "users-bus" || aws.ToString(e.Source) != "my.source" || aws.ToString(e.DetailType) != "user.updated" {
+		t.Errorf("unexpected entry bus=%q source=%q detail-type=%q", aws.ToString(e.EventBusName), aws.ToString(e.Source), aws.ToString(e.DetailType))
+	}
+	checkEnvelope(t, aws.ToString(e.Detail))
+
+	// A rejected entry is an error even though the call succeeded
+	client.out = eventbridge.PutEventsOutput{FailedEntryCount: 1, Entries: []ebtypes.PutEventsResultEntry{{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("try again")}}}
+	err := NewEventBridgePublisher(client, "users-bus", "my.source").PublishUserDeleted(context.Background(), UserDeletedEventPayload{UserID: "u1"})
+	if err == nil || !strings.Contains(err.Error(), "InternalFailure") {
+		t.Errorf("expected rejected entry error, got %v", err)
+	}
+}
+
+func TestSNSPublisher_Request(t *testing.T) {
+	client := &fakeSNS{}
+	pub := NewSNSPublisher(client, "arn:aws:sns:us-east-1:123456789012:users", "my.source")
+	ctx := WithEventMetadata(context.Background(), events.Metadata{EventID: "evt-1", CorrelationID: "corr-1", CausationID: "req-1"})
+	if err := pub.PublishUserUpdated(ctx, testUpdatedPayload); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.inputs) != 1 || aws.ToString(client.inputs[0].TopicArn) != "arn:aws:sns:us-east-1:123456789012:users" {
+		t.Fatalf("unexpected requests %+v", client.inputs)
+	}
+	in := client.inputs[0]
+	checkEnvelope(t, aws.ToString(in.Message))
+	want := map[string]string{"eventId": "evt-1", "eventType": "user.updated", "version": "1", "tenantId": "acme", "correlationId": "corr-1", "causationId": "req-1", "producer": "my.source"}
+	if len(in.MessageAttributes) != len(want) {
+		t.Errorf("attributes %v, want %v", in.MessageAttributes, want)
+	}
+	for k, v := range want {
+		if a := in.MessageAttributes[k]; aws.ToString(a.DataType) != "String" || aws.ToString(a.StringValue) != v {
+			t.Errorf("attribute %s = %s %q, want String %q", k, aws.ToString(a.DataType), aws.ToString(a.StringValue), v)
+		}
+	}
+
+	// Without a tenant there is no tenantId attribute, and client errors are returned
+	client.err = errors.New("throttled")
+	if err := pub.PublishUserRestored(context.Background(), UserRestoredEventPayload{UserID: "u1"}); err == nil {
+		t.Error("expected the client error")
+	}
+	if _, ok := client.inputs[1].MessageAttributes["tenantId"]; ok {
+		t.Error("unexpected tenantId attribute without a tenant")
+	}
+}
+
+func TestNewEventPublisher(t *testing.T) {
+	cfg := aws.Config{Region: "us-east-1"}
+	tests := []struct {
+		pc      PublisherConfig
+		want    string // publisher type when no error is expected
+		wantErr string
+	}{
+		{PublisherConfig{QueueURL: "q"}, "*users.SQSPublisher", ""},
+		{PublisherConfig{Backend: BackendEventBridge, EventBusName: "bus"}, "*users.EventBridgePublisher", ""},
+		{PublisherConfig{Backend: BackendSNS, TopicARN: "arn"}, "*users.SNSPublisher", ""},
+		{PublisherConfig{Backend: BackendSNS, QueueURL: "q"}, "", "topic ARN"},
+		{PublisherConfig{Backend: "kafka"}, "", "unknown event backend"},
+		{PublisherConfig{QueueURL: "q", Format: FormatCloudEventsBinary}, "*users.SQSPublisher", ""},
+		{PublisherConfig{QueueURL: "q", Format: "xml"}, "", "unknown message format"},
+		{PublisherConfig{Backend: BackendSNS, TopicARN: "arn", Format: FormatCloudEvents}, "", "only supported by the sqs"},
+	}
+	for _, tt := range tests {
+		pub, err := NewEventPublisher(cfg, tt.pc)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%+v: expected error containing %q, got %v", tt.pc, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", tt.pc, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", pub); got != tt.want {
+			t.Errorf("%+v: got %s, want %s", tt.pc, got, tt.want)
+		}
+	}
+	if pub, _ := NewEventPublisher(cfg, PublisherConfig{Backend: BackendEventBridge, EventBusName: "bus"}); pub.(*EventBridgePublisher).source != DefaultEventSource {
+		t.Errorf("source %q, want %q", pub.(*EventBridgePublisher).source, DefaultEventSource)
+	}
+}
@@ -0,0 +1,353 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// testRepoConformance checks the behavior every UserRepository must share, in particular which
+// domain error each failed condition returns. newRepo must return an empty repository.
+// It runs against MockRepo here and against DynamoDB Local in repo_dynamo_integration_test.go.
+func testRepoConformance(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	ctx := context.Background()
+	user := func(id, email string) *User {
+		return &User{ID: id, Email: email, Name: "Name " + id, CreatedAt: "2024-01-01T00:00:00Z", CreatedBy: "admin", Version: 1}
+	}
+
+	t.Run("Put and GetByID", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Put(ctx, &User{ID: "u1", Email: "A@B.com", Name: "Alice", Subject: "s1", CreatedAt: "2024-01-01T00:00:00Z", CreatedBy: "admin"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		got, err := repo.GetByID(ctx, "u1")
+		if err != nil || got == nil {
+			t.Fatalf("GetByID: %+v, %v", got, err)
+		}
+		if got.Email != "A@B.com" || got.Name != "Alice" || got.Subject != "s1" || got.CreatedBy != "admin" || got.Version != 1 {
+			t.Errorf("unexpected user %+v", got)
+		}
+		if got, err := repo.GetByID(ctx, "missing"); got != nil || err != nil {
+			t.Errorf("missing user: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("Put conflicts", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Put(ctx, user("u1", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Put(ctx, user("u1", "other@b.com"), nil); !errors.Is(err, ErrUserAlreadyExists) {
+			t.Errorf("duplicate id: expected ErrUserAlreadyExists, got %v", err)
+		}
+		if err := repo.Put(ctx, user("u2", " A@B.COM"), nil); !errors.Is(err, ErrEmailInUse) {
+			t.Errorf("duplicate email: expected ErrEmailInUse, got %v", err)
+		}
+		if got, _ := repo.GetByID(ctx, "u2"); got != nil {
+			t.Errorf("failed Put must not store the user, got %+v", got)
+		}
+	})
+
+	t.Run("GetByEmail and GetBySubject", func(t *testing.T) {
+		repo := newRepo(t)
+		u := user("u1", "a@b.com")
+		u.Subject = "s1"
+		if err := repo.Put(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.GetByEmail(ctx, " A@B.com "); err != nil || got == nil || got.ID != "u1" {
+			t.Errorf("GetByEmail: %+v, %v", got, err)
+		}
+		if got, err := repo.GetBySubject(ctx, "s1"); err != nil || got == nil || got.ID != "u1" {
+			t.Errorf("GetBySubject: %+v, %v", got, err)
+		}
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-02T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.GetByEmail(ctx, "a@b.com"); got != nil || err != nil {
+			t.Errorf("GetByEmail of deleted user: %+v, %v", got, err)
+		}
+		if got, err := repo.GetBySubject(ctx, "s1"); got != nil || err != nil {
+			t.Errorf("GetBySubject of deleted user: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("subject reservation", func(t *testing.T) {
+		repo := newRepo(t)
+		linked := func(id, email string) *User {
+			u := user(id, email)
+			u.Subject = "s1"
+			return u
+		}
+		if err := repo.Put(ctx, linked("u1", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Put(ctx, linked("u2", "c@d.com"), nil); !errors.Is(err, ErrSubjectInUse) {
+			t.Errorf("duplicate subject: expected ErrSubjectInUse, got %v", err)
+		}
+		if got, _ := repo.GetByID(ctx, "u2"); got != nil {
+			t.Errorf("failed Put must not store the user, got %+v", got)
+		}
+		// Users without a subject do not reserve one
+		if err := repo.Put(ctx, user("u3", "e@f.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// Deleting u1 releases the subject; restoring u1 fails once u2 has taken it
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-02T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Put(ctx, linked("u2", "c@d.com"), nil); err != nil {
+			t.Fatalf("subject of deleted user should be free: %v", err)
+		}
+		if _, err := repo.Restore(ctx, "u1", "t", "admin"); !errors.Is(err, ErrSubjectInUse) {
+			t.Errorf("subject taken meanwhile: expected ErrSubjectInUse, got %v", err)
+		}
+		if got, _ := repo.GetByID(ctx, "u1"); got != nil {
+			t.Errorf("failed Restore must leave the user deleted, got %+v", got)
+		}
+		if err := repo.SoftDelete(ctx, "u2", "2024-01-03T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.Restore(ctx, "u1", "2024-01-04T00:00:00Z", "admin"); err != nil || got.Subject != "s1" {
+			t.Fatalf("Restore: %+v, %v", got, err)
+		}
+		if err := repo.Put(ctx, linked("u4", "g@h.com"), nil); !errors.Is(err, ErrSubjectInUse) {
+			t.Errorf("restored user should hold the subject again, got %v", err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, u := range []*User{user("u1", "a@b.com"), user("u2", "c@d.com")} {
+			if err := repo.Put(ctx, u, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := repo.Update(ctx, "u1", UserUpdate{Name: strPtr("Alicia"), UpdatedAt: "2024-01-02T00:00:00Z", UpdatedBy: "u1"}, IfVersion(1))
+		if err != nil || got.Name != "Alicia" || got.UpdatedBy != "u1" || got.Version != 2 {
+			t.Fatalf("Update name: %+v, %v", got, err)
+		}
+		if _, err := repo.Update(ctx, "u1", UserUpdate{Name: strPtr("X"), UpdatedAt: "t", UpdatedBy: "u1"}, IfVersion(1)); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("stale version: expected ErrVersionMismatch, got %v", err)
+		}
+		if _, err := repo.Update(ctx, "u1", UserUpdate{Email: strPtr("C@d.com"), UpdatedAt: "t", UpdatedBy: "u1"}); !errors.Is(err, ErrEmailInUse) {
+			t.Errorf("taken email: expected ErrEmailInUse, got %v", err)
+		}
+		if _, err := repo.Update(ctx, "missing", UserUpdate{Name: strPtr("X"), UpdatedAt: "t", UpdatedBy: "u1"}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("missing user: expected ErrUserNotFound, got %v", err)
+		}
+
+		got, err = repo.Update(ctx, "u1", UserUpdate{Email: strPtr("new@b.com"), UpdatedAt: "2024-01-03T00:00:00Z", UpdatedBy: "u1"}, IfVersion(2))
+		if err != nil || got.Email != "new@b.com" || got.Version != 3 {
+			t.Fatalf("Update email: %+v, %v", got, err)
+		}
+		// The old email is released and the new one reserved
+		if err := repo.Put(ctx, user("u3", "a@b.com"), nil); err != nil {
+			t.Errorf("old email should be free: %v", err)
+		}
+		if err := repo.Put(ctx, user("u4", "new@b.com"), nil); !errors.Is(err, ErrEmailInUse) {
+			t.Errorf("new email should be reserved, got %v", err)
+		}
+	})
+
+	t.Run("concurrent email changes", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Put(ctx, user("u1", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		// Every change races the others between its read and its write; losing a race must not
+		// look like a missing user
+		const writers = 5
+		errs := make(chan error, writers)
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repo.Update(ctx, "u1", UserUpdate{Email: strPtr(fmt.Sprintf("new%d@b.com", i)), UpdatedAt: "t", UpdatedBy: "u1"})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil && !errors.Is(err, ErrVersionMismatch) {
+				t.Errorf("concurrent email change: expected success or ErrVersionMismatch, got %v", err)
+			}
+		}
+
+		// Only the final email stays reserved
+		got, err := repo.GetByID(ctx, "u1")
+		if err != nil || got == nil {
+			t.Fatalf("GetByID: %+v, %v", got, err)
+		}
+		if err := repo.Put(ctx, user("u2", "a@b.com"), nil); err != nil {
+			t.Errorf("original email should be free: %v", err)
+		}
+		for i := 0; i < writers; i++ {
+			email := fmt.Sprintf("new%d@b.com", i)
+			err := repo.Put(ctx, user(fmt.Sprintf("other%d", i), email), nil)
+			if email == got.Email && !errors.Is(err, ErrEmailInUse) {
+				t.Errorf("final email %s should be reserved, got %v", email, err)
+			}
+			if email != got.Email && err != nil {
+				t.Errorf("email %s should be free: %v", email, err)
+			}
+		}
+	})
+
+	t.Run("SoftDelete", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Put(ctx, user("u1", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-02T00:00:00Z", "admin", IfVersion(2)); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("stale version: expected ErrVersionMismatch, got %v", err)
+		}
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-02T00:00:00Z", "admin", IfVersion(1)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.GetByID(ctx, "u1"); got != nil || err != nil {
+			t.Errorf("deleted user must be hidden: %+v, %v", got, err)
+		}
+		got, err := repo.GetByID(ctx, "u1", IncludeDeleted())
+		if err != nil || got == nil || got.DeletedAt != "2024-01-02T00:00:00Z" || got.DeletedBy != "admin" || got.Version != 2 {
+			t.Errorf("IncludeDeleted: %+v, %v", got, err)
+		}
+		if err := repo.SoftDelete(ctx, "u1", "t", "admin"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("already deleted: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.SoftDelete(ctx, "missing", "t", "admin"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("missing user: expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.Update(ctx, "u1", UserUpdate{Name: strPtr("X"), UpdatedAt: "t", UpdatedBy: "admin"}); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("update of deleted user: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.Put(ctx, user("u2", "a@b.com"), nil); err != nil {
+			t.Errorf("email of deleted user should be free: %v", err)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Put(ctx, user("u1", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Restore(ctx, "u1", "t", "admin"); !errors.Is(err, ErrUserNotDeleted) {
+			t.Errorf("active user: expected ErrUserNotDeleted, got %v", err)
+		}
+		if _, err := repo.Restore(ctx, "missing", "t", "admin"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("missing user: expected ErrUserNotFound, got %v", err)
+		}
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-02T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Restore(ctx, "u1", "t", "admin", IfVersion(1)); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("stale version: expected ErrVersionMismatch, got %v", err)
+		}
+		got, err := repo.Restore(ctx, "u1", "2024-01-03T00:00:00Z", "admin", IfVersion(2))
+		if err != nil || got.DeletedAt != "" || got.DeletedBy != "" || got.UpdatedAt != "2024-01-03T00:00:00Z" || got.Version != 3 {
+			t.Fatalf("Restore: %+v, %v", got, err)
+		}
+
+		// Another user takes the email while u1 is deleted
+		if err := repo.SoftDelete(ctx, "u1", "2024-01-04T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Put(ctx, user("u2", "a@b.com"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.Restore(ctx, "u1", "t", "admin"); !errors.Is(err, ErrEmailInUse) {
+			t.Errorf("email taken meanwhile: expected ErrEmailInUse, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := newRepo(t)
+		for i := 1; i <= 5; i++ {
+			u := user(fmt.Sprintf("u%d", i), fmt.Sprintf("u%d@b.com", i))
+			u.CreatedAt = fmt.Sprintf("2024-01-0%dT00:00:00Z", i)
+			if err := repo.Put(ctx, u, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := repo.SoftDelete(ctx, "u3", "2024-02-01T00:00:00Z", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		opts := ListOptions{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatal("pagination does not terminate")
+			}
+			page, err := repo.List(ctx, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range page.Items {
+				ids = append(ids, u.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			opts.Cursor = page.NextCursor
+		}
+		if fmt.Sprint(ids) != "[u1 u2 u4 u5]" {
+			t.Errorf("listed %v, want [u1 u2 u4 u5]", ids)
+		}
+		if _, err := repo.List(ctx, ListOptions{Limit: 2, Cursor: "bogus"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("bogus cursor: expected ErrInvalidCursor, got %v", err)
+		}
+	})
+
+	t.Run("tenant isolation", func(t *testing.T) {
+		repo := newRepo(t)
+		acme, globex := SetTenantID(ctx, "acme"), SetTenantID(ctx, "globex")
+		for _, c := range []context.Context{acme, globex} {
+			if err := repo.Put(c, user("u1", "a@b.com"), nil); err != nil {
+				t.Fatalf("Put in %s: %v", getTenantID(c), err)
+			}
+		}
+		if err := repo.SoftDelete(acme, "u1", "t", "admin"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := repo.GetByID(globex, "u1"); err != nil || got == nil {
+			t.Errorf("globex u1 must be unaffected: %+v, %v", got, err)
+		}
+		if got, err := repo.GetByID(ctx, "u1"); got != nil || err != nil {
+			t.Errorf("no tenant must not see tenant users: %+v, %v", got, err)
+		}
+		page, err := repo.List(globex, ListOptions{Limit: 1})
+		if err != nil || len(page.Items) != 1 {
+			t.Fatalf("globex list: %+v, %v", page, err)
+		}
+	})
+
+	t.Run("outbox", func(t *testing.T) {
+		repo := newRepo(t)
+		msg := &OutboxMessage{ID: "m1", EventType: "user.created", Payload: []byte(`{"userId":"u1"}`), CreatedAt: "2024-01-01T00:00:00Z"}
+		if err := repo.Put(ctx, user("u1", "a@b.com"), msg); err != nil {
+			t.Fatal(err)
+		}
+		pending, err := repo.ListPendingOutbox(ctx, 10)
+		if err != nil || len(pending) != 1 || pending[0].ID != "m1" || string(pending[0].Payload) != `{"userId":"u1"}` {
+			t.Fatalf("ListPendingOutbox: %+v, %v", pending, err)
+		}
+		if err := repo.MarkOutboxSent(ctx, "m1"); err != nil {
+			t.Fatal(err)
+		}
+		if pending, err := repo.ListPendingOutbox(ctx, 10); err != nil || len(pending) != 0 {
+			t.Errorf("sent message still pending: %+v, %v", pending, err)
+		}
+		if err := repo.MarkOutboxSent(ctx, "missing"); !errors.Is(err, ErrOutboxMessageNotFound) {
+			t.Errorf("missing message: expected ErrOutboxMessageNotFound, got %v", err)
+		}
+	})
+}
+
+func TestMockRepo_Conformance(t *testing.T) {
+	testRepoConformance(t, func(t *testing.T) UserRepository { return NewMockRepo() })
+}
@@ -2,8 +2,13 @@ package users
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -12,70 +17,339 @@ import (
 const (
 	pkPrefix = "USER#"
 	skValue  = "PROFILE"
+
+	// Email reservation items (pk EMAIL#<normalized>, sk EMAIL) enforce unique emails across users.
+	emailPKPrefix = "EMAIL#"
+	emailSKValue  = "EMAIL"
+	// Subject reservation items (pk SUBJECT#<sub>, sk SUBJECT) link a JWT subject to at most one active user.
+	subjectPKPrefix = "SUBJECT#"
+	subjectSKValue  = "SUBJECT"
+
+	// userEntityType is the entityType value of profile items, after the tenant prefix; it is the partition
+	// key of listIndexName.
+	userEntityType = "USER"
+	// listIndexName is the GSI (entityType HASH, createdAt RANGE) used to list users without a Scan.
+	listIndexName = "entityType-createdAt-index"
+	// Outbox items (pk OUTBOX#<id>, sk OUTBOX) hold events written with the state change.
+	// Pending items carry entityType outboxPendingType so the relay can query them on listIndexName;
+	// once sent, entityType is removed (dropping them from the index) and expiresAt lets TTL delete them.
+	outboxPKPrefix    = "OUTBOX#"
+	outboxSKValue     = "OUTBOX"
+	outboxPendingType = "OUTBOX#PENDING"
+	outboxSentTTL     = 7 * 24 * time.Hour
+
+	// emailIndexName is the GSI (emailNormalized HASH) used by GetByEmail.
+	emailIndexName = "emailNormalized-index"
+	// subjectIndexName is the sparse GSI (subjectKey HASH, createdAt RANGE) used by GetBySubject;
+	// only users linked to a JWT subject are in it.
+	subjectIndexName = "subject-createdAt-index"
 )
 
 // DynamoRepo implements UserRepository with DynamoDB.
+//
+// Every user, email and subject reservation and index key is prefixed with the tenant from the context
+// (TENANT#<tenant>#USER#<id>, TENANT#<tenant>#EMAIL#..., entityType TENANT#<tenant>#USER), so a
+// tenant can only address its own items. Without a tenant the keys have no prefix. Outbox items are
+// not tenant-scoped: the relay drains them for all tenants, and each message carries its TenantID.
 type DynamoRepo struct {
 	client    *dynamodb.Client
 	tableName string
+	cursorKey []byte // HMAC key for List cursors
 }
 
-// NewDynamoRepo returns a DynamoRepo.
-func NewDynamoRepo(client *dynamodb.Client, tableName string) *DynamoRepo {
-	return &DynamoRepo{client: client, tableName: tableName}
+// NewDynamoRepo returns a DynamoRepo. cursorKey signs the pagination cursors returned by List.
+func NewDynamoRepo(client *dynamodb.Client, tableName string, cursorKey []byte) *DynamoRepo {
+	return &DynamoRepo{client: client, tableName: tableName, cursorKey: cursorKey}
 }
 
 // dynamoUser is the stored item shape (pk, sk, and attributes).
 type dynamoUser struct {
-	PK        string `dynamodbav:"pk"`
-	SK        string `dynamodbav:"sk"`
-	ID        string `dynamodbav:"id"`
-	Email     string `dynamodbav:"email"`
-	Name      string `dynamodbav:"name"`
-	CreatedAt string `dynamodbav:"createdAt"`
-	CreatedBy string `dynamodbav:"createdBy"`
+	PK         string `dynamodbav:"pk"`
+	SK         string `dynamodbav:"sk"`
+	EntityType string `dynamodbav:"entityType"`
+	ID         string `dynamodbav:"id"`
+	Email      string `dynamodbav:"email"`
+	TenantID   string `dynamodbav:"tenantId,omitempty"`
+	// EmailNormalized is NormalizeEmail(Email) with the tenant prefix; partition key of emailIndexName.
+	EmailNormalized string `dynamodbav:"emailNormalized"`
+	Name            string `dynamodbav:"name"`
+	Subject         string `dynamodbav:"subject,omitempty"`
+	// SubjectKey is Subject with the tenant prefix; partition key of subjectIndexName.
+	SubjectKey string `dynamodbav:"subjectKey,omitempty"`
+	CreatedAt  string `dynamodbav:"createdAt"`
+	CreatedBy  string `dynamodbav:"createdBy"`
+	UpdatedAt  string `dynamodbav:"updatedAt,omitempty"`
+	UpdatedBy  string `dynamodbav:"updatedBy,omitempty"`
+	DeletedAt  string `dynamodbav:"deletedAt,omitempty"`
+	DeletedBy  string `dynamodbav:"deletedBy,omitempty"`
+	Version    int64  `dynamodbav:"version,omitempty"`
 }
 
-func toDynamo(u *User) dynamoUser {
-	return dynamoUser{
-		PK:        pkPrefix + u.ID,
-		SK:        skValue,
-		ID:        u.ID,
-		Email:     u.Email,
-		Name:      u.Name,
-		CreatedAt: u.CreatedAt,
-		CreatedBy: u.CreatedBy,
+func toDynamo(ctx context.Context, u *User) dynamoUser {
+	prefix := tenantPrefix(ctx)
+	du := dynamoUser{
+		PK:              prefix + pkPrefix + u.ID,
+		SK:              skValue,
+		EntityType:      prefix + userEntityType,
+		TenantID:        getTenantID(ctx),
+		ID:              u.ID,
+		Email:           u.Email,
+		EmailNormalized: prefix + NormalizeEmail(u.Email),
+		Name:            u.Name,
+		Subject:         u.Subject,
+		CreatedAt:       u.CreatedAt,
+		CreatedBy:       u.CreatedBy,
+		UpdatedAt:       u.UpdatedAt,
+		UpdatedBy:       u.UpdatedBy,
+		DeletedAt:       u.DeletedAt,
+		DeletedBy:       u.DeletedBy,
+		Version:         u.Version,
 	}
+	if u.Subject != "" {
+		du.SubjectKey = prefix + u.Subject
+	}
+	return du
 }
 
-func (d *DynamoRepo) Put(ctx context.Context, u *User) error {
-	item, err := attributevalue.MarshalMap(toDynamo(u))
-	if err != nil {
-		return fmt.Errorf("marshal user: %w", err)
+func fromDynamo(du dynamoUser) *User {
+	return &User{
+		ID:        du.ID,
+		Email:     du.Email,
+		Name:      du.Name,
+		Subject:   du.Subject,
+		CreatedAt: du.CreatedAt,
+		CreatedBy: du.CreatedBy,
+		UpdatedAt: du.UpdatedAt,
+		UpdatedBy: du.UpdatedBy,
+		DeletedAt: du.DeletedAt,
+		DeletedBy: du.DeletedBy,
+		Version:   storedVersion(&du),
+	}
+}
+
+func userKey(ctx context.Context, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + pkPrefix + id},
+		"sk": &types.AttributeValueMemberS{Value: skValue},
 	}
-	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+}
+
+// emailKey is the key of the item that reserves a normalized email for one user.
+func emailKey(ctx context.Context, email string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + emailPKPrefix + NormalizeEmail(email)},
+		"sk": &types.AttributeValueMemberS{Value: emailSKValue},
+	}
+}
+
+// reserveEmail is the transaction item that claims email for userID, failing if it is taken.
+func (d *DynamoRepo) reserveEmail(ctx context.Context, email, userID string) types.TransactWriteItem {
+	item := emailKey(ctx, email)
+	item["userId"] = &types.AttributeValueMemberS{Value: userID}
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:           &d.tableName,
+		Item:                item,
+		ConditionExpression: ptr("attribute_not_exists(pk)"),
+	}}
+}
+
+// releaseEmail is the transaction item that frees the reservation of email.
+func (d *DynamoRepo) releaseEmail(ctx context.Context, email string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
 		TableName: &d.tableName,
-		Item:      item,
+		Key:       emailKey(ctx, email),
+	}}
+}
+
+// subjectKey is the key of the item that reserves a JWT subject for one user.
+func subjectKey(ctx context.Context, subject string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + subjectPKPrefix + subject},
+		"sk": &types.AttributeValueMemberS{Value: subjectSKValue},
+	}
+}
+
+// reserveSubject is the transaction item that claims subject for userID, failing if it is taken.
+func (d *DynamoRepo) reserveSubject(ctx context.Context, subject, userID string) types.TransactWriteItem {
+	item := subjectKey(ctx, subject)
+	item["userId"] = &types.AttributeValueMemberS{Value: userID}
+	return types.TransactWriteItem{Put: &types.Put{
+		TableName:           &d.tableName,
+		Item:                item,
 		ConditionExpression: ptr("attribute_not_exists(pk)"),
+	}}
+}
+
+// releaseSubject is the transaction item that frees the reservation of subject.
+func (d *DynamoRepo) releaseSubject(ctx context.Context, subject string) types.TransactWriteItem {
+	return types.TransactWriteItem{Delete: &types.Delete{
+		TableName: &d.tableName,
+		Key:       subjectKey(ctx, subject),
+	}}
+}
+
+// dynamoOutbox is the stored shape of an OutboxMessage.
+type dynamoOutbox struct {
+	PK         string `dynamodbav:"pk"`
+	SK         string `dynamodbav:"sk"`
+	EntityType string `dynamodbav:"entityType,omitempty"`
+	ID         string `dynamodbav:"id"`
+	EventType  string `dynamodbav:"eventType"`
+	Payload    string `dynamodbav:"payload"`
+	CreatedAt  string `dynamodbav:"createdAt"`
+	// Event metadata; absent on messages written before it was recorded
+	CorrelationID string `dynamodbav:"correlationId,omitempty"`
+	CausationID   string `dynamodbav:"causationId,omitempty"`
+	TraceParent   string `dynamodbav:"traceparent,omitempty"`
+}
+
+func outboxKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: outboxPKPrefix + id},
+		"sk": &types.AttributeValueMemberS{Value: outboxSKValue},
+	}
+}
+
+// Put writes the profile, its email and subject reservations and, if msg is non-nil, the outbox message in
+// one transaction. Returns ErrUserAlreadyExists if the id is taken, ErrEmailInUse if the email is taken and
+// ErrSubjectInUse if another user is linked to the subject.
+func (d *DynamoRepo) Put(ctx context.Context, u *User, msg *OutboxMessage) error {
+	item, err := attributevalue.MarshalMap(toDynamo(ctx, u))
+	if err != nil {
+		return fmt.Errorf("marshal user: %w", err)
+	}
+	txItems := []types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:           &d.tableName,
+			Item:                item,
+			ConditionExpression: ptr("attribute_not_exists(pk)"),
+		}},
+		d.reserveEmail(ctx, u.Email, u.ID),
+	}
+	if u.Subject != "" {
+		txItems = append(txItems, d.reserveSubject(ctx, u.Subject, u.ID))
+	}
+	if msg != nil {
+		outboxItem, err := attributevalue.MarshalMap(dynamoOutbox{
+			PK:         outboxPKPrefix + msg.ID,
+			SK:         outboxSKValue,
+			EntityType: outboxPendingType,
+			ID:         msg.ID,
+			EventType:  msg.EventType,
+			Payload:    string(msg.Payload),
+			CreatedAt:  msg.CreatedAt,
+
+			CorrelationID: msg.CorrelationID,
+			CausationID:   msg.CausationID,
+			TraceParent:   msg.TraceParent,
+		})
+		if err != nil {
+			return fmt.Errorf("marshal outbox message: %w", err)
+		}
+		txItems = append(txItems, types.TransactWriteItem{Put: &types.Put{
+			TableName:           &d.tableName,
+			Item:                outboxItem,
+			ConditionExpression: ptr("attribute_not_exists(pk)"),
+		}})
+	}
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: txItems,
 	})
 	if err != nil {
+		if txConditionFailed(err, 0) {
+			return ErrUserAlreadyExists
+		}
+		if txConditionFailed(err, 1) {
+			return ErrEmailInUse
+		}
+		if u.Subject != "" && txConditionFailed(err, 2) {
+			return ErrSubjectInUse
+		}
 		return err
 	}
 	return nil
 }
 
-func (d *DynamoRepo) GetByID(ctx context.Context, id string) (*User, error) {
-	pk := pkPrefix + id
-	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: &d.tableName,
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: pk},
-			"sk": &types.AttributeValueMemberS{Value: skValue},
+// GetByID returns the user by id, or nil if not found. Soft-deleted users are treated as not found
+// unless IncludeDeleted is passed.
+func (d *DynamoRepo) GetByID(ctx context.Context, id string, opts ...GetOption) (*User, error) {
+	du, err := d.getItem(ctx, id, false)
+	if err != nil || du == nil {
+		return nil, err
+	}
+	if du.DeletedAt != "" && !applyGetOptions(opts).IncludeDeleted {
+		return nil, nil
+	}
+	return fromDynamo(*du), nil
+}
+
+// GetByEmail returns the active user whose normalized email matches, or nil if none.
+// It queries emailIndexName, so results are eventually consistent.
+func (d *DynamoRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	out, err := d.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		IndexName:              ptr(emailIndexName),
+		KeyConditionExpression: ptr("emailNormalized = :email"),
+		FilterExpression:       ptr("attribute_not_exists(deletedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":email": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + NormalizeEmail(email)},
 		},
 	})
 	if err != nil {
 		return nil, err
 	}
+	if len(out.Items) == 0 {
+		return nil, nil
+	}
+	var du dynamoUser
+	if err := attributevalue.UnmarshalMap(out.Items[0], &du); err != nil {
+		return nil, fmt.Errorf("unmarshal user: %w", err)
+	}
+	return fromDynamo(du), nil
+}
+
+// GetBySubject returns the oldest active user linked to the JWT subject, or nil if none.
+// It queries subjectIndexName, so results are eventually consistent.
+func (d *DynamoRepo) GetBySubject(ctx context.Context, subject string) (*User, error) {
+	var startKey map[string]types.AttributeValue
+	for {
+		out, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              &d.tableName,
+			IndexName:              ptr(subjectIndexName),
+			KeyConditionExpression: ptr("subjectKey = :subject"),
+			FilterExpression:       ptr("attribute_not_exists(deletedAt)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":subject": &types.AttributeValueMemberS{Value: tenantPrefix(ctx) + subject},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(out.Items) > 0 {
+			var du dynamoUser
+			if err := attributevalue.UnmarshalMap(out.Items[0], &du); err != nil {
+				return nil, fmt.Errorf("unmarshal user: %w", err)
+			}
+			return fromDynamo(du), nil
+		}
+		// The filter may empty a page of deleted users; keep reading until the index is exhausted
+		if out.LastEvaluatedKey == nil {
+			return nil, nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+func (d *DynamoRepo) getItem(ctx context.Context, id string, consistent bool) (*dynamoUser, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &d.tableName,
+		Key:            userKey(ctx, id),
+		ConsistentRead: aws.Bool(consistent),
+	})
+	if err != nil {
+		return nil, err
+	}
 	if out.Item == nil {
 		return nil, nil
 	}
@@ -83,13 +357,405 @@ func (d *DynamoRepo) GetByID(ctx context.Context, id string) (*User, error) {
 	if err := attributevalue.UnmarshalMap(out.Item, &du); err != nil {
 		return nil, fmt.Errorf("unmarshal user: %w", err)
 	}
-	return &User{
-		ID:        du.ID,
-		Email:     du.Email,
-		Name:      du.Name,
-		CreatedAt: du.CreatedAt,
-		CreatedBy: du.CreatedBy,
-	}, nil
+	return &du, nil
+}
+
+// Update applies a partial update, conditional on the item existing and not being deleted, and bumps
+// its version. When the normalized email changes, the email reservation is moved in the same transaction.
+// An email move that races another update is redone without IfVersion and fails with ErrVersionMismatch with it.
+// Returns ErrUserNotFound if the user does not exist or is deleted, ErrEmailInUse if the new email is taken
+// and ErrVersionMismatch if IfVersion does not match.
+func (d *DynamoRepo) Update(ctx context.Context, id string, upd UserUpdate, opts ...WriteOption) (*User, error) {
+	ifVersion := applyWriteOptions(opts).IfVersion
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{}
+	var sets []string
+	set := func(attr, value string) {
+		names["#"+attr] = attr
+		values[":"+attr] = &types.AttributeValueMemberS{Value: value}
+		sets = append(sets, "#"+attr+" = :"+attr)
+	}
+	if upd.Email != nil {
+		set("email", *upd.Email)
+		set("emailNormalized", tenantPrefix(ctx)+NormalizeEmail(*upd.Email))
+	}
+	if upd.Name != nil {
+		set("name", *upd.Name)
+	}
+	set("updatedAt", upd.UpdatedAt)
+	set("updatedBy", upd.UpdatedBy)
+	sets = append(sets, bumpVersion(names, values))
+
+	for attempt := 1; upd.Email != nil; attempt++ {
+		current, err := d.getItem(ctx, id, true)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || current.DeletedAt != "" {
+			return nil, ErrUserNotFound
+		}
+		if ifVersion != 0 && storedVersion(current) != ifVersion {
+			return nil, ErrVersionMismatch
+		}
+		if NormalizeEmail(current.Email) == NormalizeEmail(*upd.Email) {
+			break
+		}
+		u, err := d.updateWithEmailMove(ctx, id, current.Email, *upd.Email, ifVersion, sets, names, values)
+		if errors.Is(err, errEmailMoveRaced) {
+			// Without If-Match the caller asked for no precondition, so the move is redone on the new state
+			if ifVersion == 0 && attempt < maxEmailMoveAttempts {
+				continue
+			}
+			return nil, ErrVersionMismatch
+		}
+		return u, err
+	}
+
+	out, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           &d.tableName,
+		Key:                                 userKey(ctx, id),
+		UpdateExpression:                    ptr("SET " + strings.Join(sets, ", ")),
+		ConditionExpression:                 ptr("attribute_exists(pk) AND attribute_not_exists(deletedAt)" + versionCondition(ifVersion, values)),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           values,
+		ReturnValues:                        types.ReturnValueAllNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			// The old item tells a missing or deleted user apart from a stale version
+			if _, deleted := ccf.Item["deletedAt"]; ccf.Item == nil || deleted {
+				return nil, ErrUserNotFound
+			}
+			return nil, ErrVersionMismatch
+		}
+		return nil, err
+	}
+	var du dynamoUser
+	if err := attributevalue.UnmarshalMap(out.Attributes, &du); err != nil {
+		return nil, fmt.Errorf("unmarshal user: %w", err)
+	}
+	return fromDynamo(du), nil
+}
+
+// maxEmailMoveAttempts bounds how often Update redoes an email move that lost a race.
+const maxEmailMoveAttempts = 3
+
+// errEmailMoveRaced is returned by updateWithEmailMove when the user was modified between the read and
+// the transaction.
+var errEmailMoveRaced = errors.New("user modified during email move")
+
+// updateWithEmailMove updates the profile, releases oldEmail and reserves newEmail atomically.
+// The profile condition pins the old email so a concurrent email change cannot leak a reservation.
+// When the profile condition fails, a consistent re-read tells a missing or deleted user
+// (ErrUserNotFound) from a concurrent modification (errEmailMoveRaced).
+func (d *DynamoRepo) updateWithEmailMove(ctx context.Context, id, oldEmail, newEmail string, ifVersion int64, sets []string, names map[string]string, values map[string]types.AttributeValue) (*User, error) {
+	values[":oldEmail"] = &types.AttributeValueMemberS{Value: oldEmail}
+	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Update: &types.Update{
+				TableName:                 &d.tableName,
+				Key:                       userKey(ctx, id),
+				UpdateExpression:          ptr("SET " + strings.Join(sets, ", ")),
+				ConditionExpression:       ptr("attribute_exists(pk) AND attribute_not_exists(deletedAt) AND #email = :oldEmail" + versionCondition(ifVersion, values)),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			}},
+			d.releaseEmail(ctx, oldEmail),
+			d.reserveEmail(ctx, newEmail, id),
+		},
+	})
+	if err != nil {
+		if txConditionFailed(err, 0) {
+			current, getErr := d.getItem(ctx, id, true)
+			if getErr != nil {
+				return nil, getErr
+			}
+			if current == nil || current.DeletedAt != "" {
+				return nil, ErrUserNotFound
+			}
+			return nil, errEmailMoveRaced
+		}
+		if txConditionFailed(err, 2) {
+			return nil, ErrEmailInUse
+		}
+		return nil, err
+	}
+	return d.reload(ctx, id)
+}
+
+// SoftDelete sets deletedAt/deletedBy on the profile item instead of removing it, and releases the
+// email and subject reservations in the same transaction so both can be registered again.
+// Returns ErrUserNotFound if the user does not exist or is already deleted and ErrVersionMismatch
+// if IfVersion does not match.
+func (d *DynamoRepo) SoftDelete(ctx context.Context, id, deletedAt, deletedBy string, opts ...WriteOption) error {
+	ifVersion := applyWriteOptions(opts).IfVersion
+	current, err := d.getItem(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.DeletedAt != "" {
+		return ErrUserNotFound
+	}
+	if ifVersion != 0 && storedVersion(current) != ifVersion {
+		return ErrVersionMismatch
+	}
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":deletedAt": &types.AttributeValueMemberS{Value: deletedAt},
+		":deletedBy": &types.AttributeValueMemberS{Value: deletedBy},
+		":email":     &types.AttributeValueMemberS{Value: current.Email},
+	}
+	txItems := []types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName:                 &d.tableName,
+			Key:                       userKey(ctx, id),
+			UpdateExpression:          ptr("SET deletedAt = :deletedAt, deletedBy = :deletedBy, " + bumpVersion(names, values)),
+			ConditionExpression:       ptr("attribute_exists(pk) AND attribute_not_exists(deletedAt) AND email = :email" + versionCondition(ifVersion, values)),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}},
+		d.releaseEmail(ctx, current.Email),
+	}
+	if current.Subject != "" {
+		txItems = append(txItems, d.releaseSubject(ctx, current.Subject))
+	}
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: txItems,
+	})
+	if err != nil {
+		if txConditionFailed(err, 0) {
+			if ifVersion != 0 {
+				return ErrVersionMismatch
+			}
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Restore clears deletedAt/deletedBy, records the restore as an update and re-reserves the email and
+// subject. Returns ErrUserNotFound if the user does not exist, ErrUserNotDeleted if it is not deleted,
+// ErrEmailInUse or ErrSubjectInUse if another user took the email or subject while this one was deleted
+// and ErrVersionMismatch if IfVersion does not match.
+func (d *DynamoRepo) Restore(ctx context.Context, id, restoredAt, restoredBy string, opts ...WriteOption) (*User, error) {
+	ifVersion := applyWriteOptions(opts).IfVersion
+	current, err := d.getItem(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrUserNotFound
+	}
+	if current.DeletedAt == "" {
+		return nil, ErrUserNotDeleted
+	}
+	if ifVersion != 0 && storedVersion(current) != ifVersion {
+		return nil, ErrVersionMismatch
+	}
+	names := map[string]string{}
+	values := map[string]types.AttributeValue{
+		":updatedAt": &types.AttributeValueMemberS{Value: restoredAt},
+		":updatedBy": &types.AttributeValueMemberS{Value: restoredBy},
+		":email":     &types.AttributeValueMemberS{Value: current.Email},
+	}
+	txItems := []types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName:                 &d.tableName,
+			Key:                       userKey(ctx, id),
+			UpdateExpression:          ptr("SET updatedAt = :updatedAt, updatedBy = :updatedBy, " + bumpVersion(names, values) + " REMOVE deletedAt, deletedBy"),
+			ConditionExpression:       ptr("attribute_exists(deletedAt) AND email = :email" + versionCondition(ifVersion, values)),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		}},
+		d.reserveEmail(ctx, current.Email, id),
+	}
+	if current.Subject != "" {
+		txItems = append(txItems, d.reserveSubject(ctx, current.Subject, id))
+	}
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: txItems,
+	})
+	if err != nil {
+		if txConditionFailed(err, 0) {
+			if ifVersion != 0 {
+				return nil, ErrVersionMismatch
+			}
+			return nil, ErrUserNotDeleted
+		}
+		if txConditionFailed(err, 1) {
+			return nil, ErrEmailInUse
+		}
+		if current.Subject != "" && txConditionFailed(err, 2) {
+			return nil, ErrSubjectInUse
+		}
+		return nil, err
+	}
+	return d.reload(ctx, id)
+}
+
+// bumpVersion adds the #version name and :one value and returns the SET clause incrementing the version.
+// Items written before versioning have no version attribute and count as version 1.
+func bumpVersion(names map[string]string, values map[string]types.AttributeValue) string {
+	names["#version"] = "version"
+	values[":one"] = &types.AttributeValueMemberN{Value: "1"}
+	return "#version = if_not_exists(#version, :one) + :one"
+}
+
+// versionCondition returns the condition clause (to be appended with AND) pinning the version to
+// ifVersion, or "" if ifVersion is 0. It expects bumpVersion to have added the #version name.
+func versionCondition(ifVersion int64, values map[string]types.AttributeValue) string {
+	if ifVersion == 0 {
+		return ""
+	}
+	values[":ifVersion"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(ifVersion, 10)}
+	if ifVersion == 1 {
+		return " AND (attribute_not_exists(#version) OR #version = :ifVersion)"
+	}
+	return " AND #version = :ifVersion"
+}
+
+// storedVersion returns the version of du, counting items written before versioning as version 1.
+func storedVersion(du *dynamoUser) int64 {
+	if du.Version == 0 {
+		return 1
+	}
+	return du.Version
+}
+
+// reload reads a profile back with a consistent read after a transaction (which cannot return values).
+func (d *DynamoRepo) reload(ctx context.Context, id string) (*User, error) {
+	du, err := d.getItem(ctx, id, true)
+	if err != nil {
+		return nil, err
+	}
+	if du == nil {
+		return nil, ErrUserNotFound
+	}
+	return fromDynamo(*du), nil
+}
+
+// List returns active users ordered by createdAt using the listIndexName GSI.
+// Deleted users are filtered out, so a page may hold fewer than opts.Limit items while NextCursor is set.
+func (d *DynamoRepo) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	entityType := tenantPrefix(ctx) + userEntityType
+	in := &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		IndexName:              ptr(listIndexName),
+		KeyConditionExpression: ptr("entityType = :entityType"),
+		FilterExpression:       ptr("attribute_not_exists(deletedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":entityType": &types.AttributeValueMemberS{Value: entityType},
+		},
+		Limit: aws.Int32(int32(opts.Limit)),
+	}
+	if opts.Cursor != "" {
+		pos, err := decodeCursor(d.cursorKey, opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		// A cursor issued to another tenant is valid but must not start this tenant's query
+		if pos["entityType"] != entityType {
+			return nil, ErrInvalidCursor
+		}
+		startKey, err := attributevalue.MarshalMap(pos)
+		if err != nil {
+			return nil, fmt.Errorf("marshal cursor: %w", err)
+		}
+		in.ExclusiveStartKey = startKey
+	}
+	out, err := d.client.Query(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	var items []dynamoUser
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &items); err != nil {
+		return nil, fmt.Errorf("unmarshal users: %w", err)
+	}
+	page := &UserPage{Items: make([]*User, 0, len(items))}
+	for _, du := range items {
+		page.Items = append(page.Items, fromDynamo(du))
+	}
+	if len(out.LastEvaluatedKey) > 0 {
+		var pos map[string]string
+		if err := attributevalue.UnmarshalMap(out.LastEvaluatedKey, &pos); err != nil {
+			return nil, fmt.Errorf("unmarshal last evaluated key: %w", err)
+		}
+		if page.NextCursor, err = encodeCursor(d.cursorKey, pos); err != nil {
+			return nil, fmt.Errorf("encode cursor: %w", err)
+		}
+	}
+	return page, nil
+}
+
+// ListPendingOutbox returns up to limit pending outbox messages, oldest first. The index is eventually
+// consistent, so a message that was just marked sent may still be returned and delivered again.
+func (d *DynamoRepo) ListPendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	out, err := d.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              &d.tableName,
+		IndexName:              ptr(listIndexName),
+		KeyConditionExpression: ptr("entityType = :entityType"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":entityType": &types.AttributeValueMemberS{Value: outboxPendingType},
+		},
+		Limit: aws.Int32(int32(limit)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var items []dynamoOutbox
+	if err := attributevalue.UnmarshalListOfMaps(out.Items, &items); err != nil {
+		return nil, fmt.Errorf("unmarshal outbox messages: %w", err)
+	}
+	msgs := make([]OutboxMessage, 0, len(items))
+	for _, item := range items {
+		msgs = append(msgs, OutboxMessage{
+			ID:        item.ID,
+			EventType: item.EventType,
+			Payload:   []byte(item.Payload),
+			CreatedAt: item.CreatedAt,
+
+			CorrelationID: item.CorrelationID,
+			CausationID:   item.CausationID,
+			TraceParent:   item.TraceParent,
+		})
+	}
+	return msgs, nil
+}
+
+// MarkOutboxSent removes the message from the pending index and schedules it for TTL deletion.
+// Returns ErrOutboxMessageNotFound if id does not exist.
+func (d *DynamoRepo) MarkOutboxSent(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           &d.tableName,
+		Key:                 outboxKey(id),
+		UpdateExpression:    ptr("SET sentAt = :sentAt, expiresAt = :expiresAt REMOVE entityType"),
+		ConditionExpression: ptr("attribute_exists(pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sentAt":    &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+			":expiresAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(outboxSentTTL).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrOutboxMessageNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// txConditionFailed reports whether err is a cancelled transaction whose item at index failed its condition.
+func txConditionFailed(err error, index int) bool {
+	var tce *types.TransactionCanceledException
+	if !errors.As(err, &tce) || index >= len(tce.CancellationReasons) {
+		return false
+	}
+	return aws.ToString(tce.CancellationReasons[index].Code) == "ConditionalCheckFailed"
 }
 
 func ptr(s string) *string { return &s }
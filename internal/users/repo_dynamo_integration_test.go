@@ -0,0 +1,84 @@
+//go:build integration
+
+package users
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Run with DynamoDB Local listening on DYNAMODB_ENDPOINT (default http://localhost:8000):
+//
+//	docker run --rm -p 8000:8000 amazon/dynamodb-local
+//	go test -tags integration ./internal/users/
+func TestDynamoRepo_Conformance(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:8000"
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		})),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) { o.BaseEndpoint = aws.String(endpoint) })
+
+	testRepoConformance(t, func(t *testing.T) UserRepository {
+		return NewDynamoRepo(client, createTestTable(t, client), []byte("conformance-cursor-key"))
+	})
+}
+
+// createTestTable creates a fresh table with the production key schema and GSIs, deleted when t ends.
+func createTestTable(t *testing.T, client *dynamodb.Client) string {
+	t.Helper()
+	ctx := context.Background()
+	name := fmt.Sprintf("users-conformance-%d", time.Now().UnixNano())
+	str := func(attr string) types.AttributeDefinition {
+		return types.AttributeDefinition{AttributeName: aws.String(attr), AttributeType: types.ScalarAttributeTypeS}
+	}
+	key := func(attr string, kt types.KeyType) types.KeySchemaElement {
+		return types.KeySchemaElement{AttributeName: aws.String(attr), KeyType: kt}
+	}
+	gsi := func(index string, schema ...types.KeySchemaElement) types.GlobalSecondaryIndex {
+		return types.GlobalSecondaryIndex{
+			IndexName:  aws.String(index),
+			KeySchema:  schema,
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		}
+	}
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:   aws.String(name),
+		BillingMode: types.BillingModePayPerRequest,
+		AttributeDefinitions: []types.AttributeDefinition{
+			str("pk"), str("sk"), str("entityType"), str("createdAt"), str("emailNormalized"), str("subjectKey"),
+		},
+		KeySchema: []types.KeySchemaElement{key("pk", types.KeyTypeHash), key("sk", types.KeyTypeRange)},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{
+			gsi(listIndexName, key("entityType", types.KeyTypeHash), key("createdAt", types.KeyTypeRange)),
+			gsi(emailIndexName, key("emailNormalized", types.KeyTypeHash)),
+			gsi(subjectIndexName, key("subjectKey", types.KeyTypeHash), key("createdAt", types.KeyTypeRange)),
+		},
+	})
+	if err != nil {
+		t.Fatalf("create table %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		_, _ = client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(name)})
+	})
+	if err := dynamodb.NewTableExistsWaiter(client).Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)}, time.Minute); err != nil {
+		t.Fatalf("wait for table %s: %v", name, err)
+	}
+	return name
+}
@@ -2,56 +2,376 @@ package users
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"sync"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
 )
 
-// ErrUserAlreadyExists is returned by MockRepo.Put when the user id already exists.
-var ErrUserAlreadyExists = errors.New("user already exists")
+// ErrUserAlreadyExists is returned by UserRepository.Put when the user id already exists.
+var ErrUserAlreadyExists = apperr.Conflict("user_already_exists", "user already exists")
+
+// ErrUserNotFound is returned by UserRepository.Update, SoftDelete and Restore when the user id
+// does not exist (or, except for Restore, is deleted).
+var ErrUserNotFound = apperr.NotFound("user_not_found", "user not found")
+
+// ErrUserNotDeleted is returned by UserRepository.Restore when the user is not deleted.
+var ErrUserNotDeleted = apperr.Conflict("user_not_deleted", "user is not deleted")
+
+// ErrEmailInUse is returned by UserRepository.Put, Update and Restore when another user holds the email.
+var ErrEmailInUse = apperr.Conflict("email_in_use", "email already in use")
+
+// ErrVersionMismatch is returned by UserRepository.Update, SoftDelete and Restore when IfVersion does
+// not match the stored version.
+var ErrVersionMismatch = apperr.PreconditionFailed("version_mismatch", "the user was modified since the given version")
+
+// ErrOutboxMessageNotFound is returned by OutboxStore.MarkOutboxSent when the message does not exist.
+var ErrOutboxMessageNotFound = apperr.NotFound("outbox_message_not_found", "outbox message not found")
 
-// MockRepo is an in-memory UserRepository for tests. It mimics DynamoDB behavior:
-// Put fails if the user id already exists (like attribute_not_exists(pk)).
+// ErrSubjectInUse is returned by UserRepository.Put and Restore when another active user is linked to the subject.
+var ErrSubjectInUse = apperr.Conflict("subject_in_use", "subject is already linked to another user")
+
+// mockCursorKey signs MockRepo cursors so tampering is detected like in DynamoRepo.
+var mockCursorKey = []byte("mock-cursor-key")
+
+// MockRepo is an in-memory UserRepository for tests. It mimics DynamoRepo, returning the same domain
+// errors for the same conditions: Put fails if the user id already exists (like attribute_not_exists(pk)),
+// emails are reserved by their normalized form like the EMAIL# items and subjects like the SUBJECT#
+// items. Users, emails and subjects are keyed by the tenant in the context, like the tenant-prefixed
+// keys of DynamoRepo. The conformance tests in repo_conformance_test.go run against both implementations.
 type MockRepo struct {
-	mu    sync.RWMutex
-	users map[string]*User
+	mu       sync.RWMutex
+	users    map[mockKey]*User
+	emails   map[mockKey]string // (tenant, normalized email) -> user id
+	subjects map[mockKey]string // (tenant, subject) -> user id
+	outbox   map[string]*mockOutboxEntry
 
 	// Optional: inject errors for tests (e.g. simulate DynamoDB/SQS failures)
-	PutError    error // if set, Put returns this error
-	GetByIDError error // if set, GetByID returns (nil, this error)
+	PutError          error // if set, Put returns this error
+	GetByIDError      error // if set, GetByID returns (nil, this error)
+	UpdateError       error // if set, Update returns (nil, this error)
+	DeleteError       error // if set, SoftDelete returns this error
+	RestoreError      error // if set, Restore returns (nil, this error)
+	ListError         error // if set, List returns (nil, this error)
+	GetByEmailError   error // if set, GetByEmail returns (nil, this error)
+	GetBySubjectError error // if set, GetBySubject returns (nil, this error)
+	MarkSentError     error // if set, MarkOutboxSent returns this error
 }
 
 // NewMockRepo returns a new MockRepo (empty store).
 func NewMockRepo() *MockRepo {
-	return &MockRepo{users: make(map[string]*User)}
+	return &MockRepo{
+		users:    make(map[mockKey]*User),
+		emails:   make(map[mockKey]string),
+		subjects: make(map[mockKey]string),
+		outbox:   make(map[string]*mockOutboxEntry),
+	}
+}
+
+// mockKey scopes a user id, normalized email or subject to a tenant ("" without one).
+type mockKey struct {
+	tenant string
+	value  string
+}
+
+type mockOutboxEntry struct {
+	msg  OutboxMessage
+	sent bool
 }
 
-// Put stores the user. Returns ErrUserAlreadyExists if id already exists.
-func (m *MockRepo) Put(ctx context.Context, u *User) error {
+// Put stores the user, reserves its email and subject and records msg (if non-nil) as pending, all or nothing.
+// Returns ErrUserAlreadyExists if id already exists, ErrEmailInUse if the email is reserved and
+// ErrSubjectInUse if the subject is reserved.
+func (m *MockRepo) Put(ctx context.Context, u *User, msg *OutboxMessage) error {
 	if m.PutError != nil {
 		return m.PutError
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.users[u.ID]; exists {
+	tenant := getTenantID(ctx)
+	if _, exists := m.users[mockKey{tenant, u.ID}]; exists {
 		return ErrUserAlreadyExists
 	}
+	if _, taken := m.emails[mockKey{tenant, NormalizeEmail(u.Email)}]; taken {
+		return ErrEmailInUse
+	}
+	if _, taken := m.subjects[mockKey{tenant, u.Subject}]; u.Subject != "" && taken {
+		return ErrSubjectInUse
+	}
 	// Store a copy so callers can't mutate
 	cp := *u
-	m.users[u.ID] = &cp
+	if cp.Version == 0 {
+		cp.Version = 1 // DynamoRepo reads a missing version as 1
+	}
+	m.users[mockKey{tenant, u.ID}] = &cp
+	m.emails[mockKey{tenant, NormalizeEmail(u.Email)}] = u.ID
+	if u.Subject != "" {
+		m.subjects[mockKey{tenant, u.Subject}] = u.ID
+	}
+	if msg != nil {
+		m.outbox[msg.ID] = &mockOutboxEntry{msg: *msg}
+	}
 	return nil
 }
 
-// GetByID returns the user by id, or nil if not found.
-func (m *MockRepo) GetByID(ctx context.Context, id string) (*User, error) {
+// GetByID returns the user by id, or nil if not found. Deleted users are nil unless IncludeDeleted is passed.
+func (m *MockRepo) GetByID(ctx context.Context, id string, opts ...GetOption) (*User, error) {
 	if m.GetByIDError != nil {
 		return nil, m.GetByIDError
 	}
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	u, ok := m.users[id]
+	u, ok := m.users[mockKey{getTenantID(ctx), id}]
 	if !ok {
 		return nil, nil
 	}
+	if u.DeletedAt != "" && !applyGetOptions(opts).IncludeDeleted {
+		return nil, nil
+	}
+	cp := *u
+	return &cp, nil
+}
+
+// GetByEmail returns the active user whose email matches after NormalizeEmail, or nil if none.
+func (m *MockRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if m.GetByEmailError != nil {
+		return nil, m.GetByEmailError
+	}
+	key := NormalizeEmail(email)
+	tenant := getTenantID(ctx)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for k, u := range m.users {
+		if k.tenant == tenant && u.DeletedAt == "" && NormalizeEmail(u.Email) == key {
+			cp := *u
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetBySubject returns the oldest active user linked to subject, or nil if none.
+func (m *MockRepo) GetBySubject(ctx context.Context, subject string) (*User, error) {
+	if m.GetBySubjectError != nil {
+		return nil, m.GetBySubjectError
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tenant := getTenantID(ctx)
+	var found *User
+	for k, u := range m.users {
+		if k.tenant == tenant && u.DeletedAt == "" && u.Subject == subject && (found == nil || userAfter(found, u.CreatedAt, u.ID)) {
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	cp := *found
+	return &cp, nil
+}
+
+// Update applies the non-nil fields of upd, moving the email reservation if the email changes.
+// Returns ErrUserNotFound if id does not exist or is deleted and ErrEmailInUse if the new email is reserved.
+func (m *MockRepo) Update(ctx context.Context, id string, upd UserUpdate, opts ...WriteOption) (*User, error) {
+	if m.UpdateError != nil {
+		return nil, m.UpdateError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant := getTenantID(ctx)
+	u, ok := m.users[mockKey{tenant, id}]
+	if !ok || u.DeletedAt != "" {
+		return nil, ErrUserNotFound
+	}
+	if !versionMatches(u, opts) {
+		return nil, ErrVersionMismatch
+	}
+	if upd.Email != nil {
+		oldKey, newKey := mockKey{tenant, NormalizeEmail(u.Email)}, mockKey{tenant, NormalizeEmail(*upd.Email)}
+		if oldKey != newKey {
+			if _, taken := m.emails[newKey]; taken {
+				return nil, ErrEmailInUse
+			}
+			delete(m.emails, oldKey)
+			m.emails[newKey] = id
+		}
+		u.Email = *upd.Email
+	}
+	if upd.Name != nil {
+		u.Name = *upd.Name
+	}
+	u.UpdatedAt = upd.UpdatedAt
+	u.UpdatedBy = upd.UpdatedBy
+	u.Version++
+	cp := *u
+	return &cp, nil
+}
+
+// SoftDelete marks the user deleted and releases its email and subject.
+// Returns ErrUserNotFound if id does not exist or is already deleted.
+func (m *MockRepo) SoftDelete(ctx context.Context, id, deletedAt, deletedBy string, opts ...WriteOption) error {
+	if m.DeleteError != nil {
+		return m.DeleteError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant := getTenantID(ctx)
+	u, ok := m.users[mockKey{tenant, id}]
+	if !ok || u.DeletedAt != "" {
+		return ErrUserNotFound
+	}
+	if !versionMatches(u, opts) {
+		return ErrVersionMismatch
+	}
+	u.DeletedAt = deletedAt
+	u.DeletedBy = deletedBy
+	u.Version++
+	delete(m.emails, mockKey{tenant, NormalizeEmail(u.Email)})
+	if u.Subject != "" {
+		delete(m.subjects, mockKey{tenant, u.Subject})
+	}
+	return nil
+}
+
+// Restore clears the deleted marker and re-reserves the email and subject. Returns ErrUserNotFound if id does
+// not exist, ErrUserNotDeleted if the user is not deleted and ErrEmailInUse or ErrSubjectInUse if the email
+// or subject was taken meanwhile.
+func (m *MockRepo) Restore(ctx context.Context, id, restoredAt, restoredBy string, opts ...WriteOption) (*User, error) {
+	if m.RestoreError != nil {
+		return nil, m.RestoreError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant := getTenantID(ctx)
+	u, ok := m.users[mockKey{tenant, id}]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if u.DeletedAt == "" {
+		return nil, ErrUserNotDeleted
+	}
+	if !versionMatches(u, opts) {
+		return nil, ErrVersionMismatch
+	}
+	emailKey := mockKey{tenant, NormalizeEmail(u.Email)}
+	if _, taken := m.emails[emailKey]; taken {
+		return nil, ErrEmailInUse
+	}
+	subjectKey := mockKey{tenant, u.Subject}
+	if _, taken := m.subjects[subjectKey]; u.Subject != "" && taken {
+		return nil, ErrSubjectInUse
+	}
+	m.emails[emailKey] = id
+	if u.Subject != "" {
+		m.subjects[subjectKey] = id
+	}
+	u.DeletedAt = ""
+	u.DeletedBy = ""
+	u.UpdatedAt = restoredAt
+	u.UpdatedBy = restoredBy
+	u.Version++
 	cp := *u
 	return &cp, nil
 }
+
+// versionMatches reports whether u satisfies the IfVersion precondition in opts.
+func versionMatches(u *User, opts []WriteOption) bool {
+	v := applyWriteOptions(opts).IfVersion
+	return v == 0 || v == u.Version
+}
+
+// List returns active users ordered by (CreatedAt, ID), which makes paging deterministic even
+// when several users share a creation timestamp.
+func (m *MockRepo) List(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if m.ListError != nil {
+		return nil, m.ListError
+	}
+	var after map[string]string
+	if opts.Cursor != "" {
+		pos, err := decodeCursor(mockCursorKey, opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if pos["tenant"] != getTenantID(ctx) {
+			return nil, ErrInvalidCursor
+		}
+		after = pos
+	}
+
+	tenant := getTenantID(ctx)
+	m.mu.RLock()
+	all := make([]*User, 0, len(m.users))
+	for k, u := range m.users {
+		if k.tenant != tenant || u.DeletedAt != "" {
+			continue
+		}
+		if after != nil && !userAfter(u, after["createdAt"], after["id"]) {
+			continue
+		}
+		cp := *u
+		all = append(all, &cp)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return userAfter(all[j], all[i].CreatedAt, all[i].ID)
+	})
+	page := &UserPage{Items: all}
+	if opts.Limit > 0 && len(all) > opts.Limit {
+		page.Items = all[:opts.Limit]
+		last := page.Items[opts.Limit-1]
+		cursor, err := encodeCursor(mockCursorKey, map[string]string{"tenant": tenant, "createdAt": last.CreatedAt, "id": last.ID})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+	return page, nil
+}
+
+// userAfter reports whether u sorts after the (createdAt, id) position.
+func userAfter(u *User, createdAt, id string) bool {
+	if u.CreatedAt != createdAt {
+		return u.CreatedAt > createdAt
+	}
+	return u.ID > id
+}
+
+// ListPendingOutbox returns up to limit unsent outbox messages ordered by (CreatedAt, ID).
+func (m *MockRepo) ListPendingOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	m.mu.RLock()
+	var msgs []OutboxMessage
+	for _, e := range m.outbox {
+		if !e.sent {
+			msgs = append(msgs, e.msg)
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(msgs, func(i, j int) bool {
+		if msgs[i].CreatedAt != msgs[j].CreatedAt {
+			return msgs[i].CreatedAt < msgs[j].CreatedAt
+		}
+		return msgs[i].ID < msgs[j].ID
+	})
+	if limit > 0 && len(msgs) > limit {
+		msgs = msgs[:limit]
+	}
+	return msgs, nil
+}
+
+// MarkOutboxSent marks the outbox message sent. Returns MarkSentError if set and
+// ErrOutboxMessageNotFound if id does not exist.
+func (m *MockRepo) MarkOutboxSent(ctx context.Context, id string) error {
+	if m.MarkSentError != nil {
+		return m.MarkSentError
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.outbox[id]
+	if !ok {
+		return ErrOutboxMessageNotFound
+	}
+	e.sent = true
+	return nil
+}
@@ -0,0 +1,180 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// apiRequest builds an API Gateway v2 event as the JWT authorizer delivers it: lowercased header
+// names and the path, including any percent-encoding, in RawPath.
+type apiRequest struct {
+	method  string
+	path    string // may carry a query string, e.g. "/users?limit=2"
+	body    string
+	claims  map[string]string
+	headers map[string]string
+}
+
+func (r apiRequest) event() events.APIGatewayV2HTTPRequest {
+	path, rawQuery, _ := strings.Cut(r.path, "?")
+	req := events.APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RouteKey:       "$default",
+		RawPath:        path,
+		RawQueryString: rawQuery,
+		Headers:        map[string]string{"content-type": "application/json"},
+		Body:           r.body,
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "req-test",
+			RouteKey:  "$default",
+			Stage:     "$default",
+			HTTP:      events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: r.method, Path: path, Protocol: "HTTP/1.1"},
+			Authorizer: &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+				JWT: &events.APIGatewayV2HTTPRequestContextAuthorizerJWTDescription{Claims: r.claims},
+			},
+		},
+	}
+	if q, err := url.ParseQuery(rawQuery); err == nil && len(q) > 0 {
+		req.QueryStringParameters = make(map[string]string, len(q))
+		for k := range q {
+			req.QueryStringParameters[k] = q.Get(k)
+		}
+	}
+	for k, v := range r.headers {
+		req.Headers[strings.ToLower(k)] = v
+	}
+	return req
+}
+
+// testAPI runs requests through the full router (middlewares, authorization and handlers) over in-memory stores.
+type testAPI struct {
+	t      *testing.T
+	router *httpapi.Router
+	svc    *Service
+	pub    *MockPublisher
+	idem   *MockIdempotencyStore
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	pub := NewMockPublisher()
+	svc := NewService(NewMockRepo(), pub)
+	idem := NewMockIdempotencyStore()
+	return &testAPI{t: t, router: NewRouter(NewHandler(svc, idem), ""), svc: svc, pub: pub, idem: idem}
+}
+
+func (a *testAPI) do(r apiRequest) events.APIGatewayV2HTTPResponse {
+	a.t.Helper()
+	resp, err := a.router.Handle(context.Background(), r.event())
+	if err != nil {
+		a.t.Fatalf("%s %s: %v", r.method, r.path, err)
+	}
+	return resp
+}
+
+// expect fails the test unless resp has status; if out is non-nil the JSON body is decoded into it.
+func (a *testAPI) expect(resp events.APIGatewayV2HTTPResponse, status int, out interface{}) {
+	a.t.Helper()
+	if resp.StatusCode != status {
+		a.t.Fatalf("status %d, want %d; body %s", resp.StatusCode, status, resp.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal([]byte(resp.Body), out); err != nil {
+			a.t.Fatalf("decode %s: %v", resp.Body, err)
+		}
+	}
+}
+
+var (
+	adminClaims  = map[string]string{"sub": "admin-1", "cognito:groups": "[admin]"}
+	writerClaims = map[string]string{"sub": "writer-1", "scope": "users:read users:write"}
+)
+
+func TestRouter_UserLifecycle(t *testing.T) {
+	api := newTestAPI(t)
+
+	resp := api.do(apiRequest{method: "POST", path: "/users", claims: writerClaims, body: `{"id":"jane@example.com","email":"Jane@Example.com","name":"Jane"}`})
+	var created User
+	api.expect(resp, 201, &created)
+	if created.ID != "jane@example.com" || created.CreatedBy != "writer-1" || resp.Headers["Content-Type"] != "application/json" {
+		t.Fatalf("created %+v, headers %v", created, resp.Headers)
+	}
+
+	// The id is URL-encoded in the path and a trailing slash is ignored
+	resp = api.do(apiRequest{method: "GET", path: "/users/jane%40example.com/", claims: writerClaims})
+	var got User
+	api.expect(resp, 200, &got)
+	if got != created || resp.Headers["ETag"] != `"1"` {
+		t.Errorf("GET: %+v, headers %v", got, resp.Headers)
+	}
+
+	var page struct {
+		Items      []User `json:"items"`
+		NextCursor string `json:"nextCursor"`
+	}
+	api.expect(api.do(apiRequest{method: "GET", path: "/users/?email=JANE%40example.com", claims: writerClaims}), 200, &page)
+	if len(page.Items) != 1 || page.Items[0].ID != created.ID {
+		t.Errorf("lookup by email: %+v", page)
+	}
+
+	resp = api.do(apiRequest{method: "PATCH", path: "/users/jane%40example.com", claims: writerClaims, body: `{"name":"Janet"}`, headers: map[string]string{"If-Match": `"1"`}})
+	api.expect(resp, 200, &got)
+	if got.Name != "Janet" || got.UpdatedBy != "writer-1" || resp.Headers["ETag"] != `"2"` {
+		t.Errorf("PATCH: %+v, headers %v", got, resp.Headers)
+	}
+
+	// Deleting needs the admin role, not just users:write
+	api.expect(api.do(apiRequest{method: "DELETE", path: "/users/jane%40example.com", claims: writerClaims, headers: map[string]string{"If-Match": `"2"`}}), 403, nil)
+	resp = api.do(apiRequest{method: "DELETE", path: "/users/jane%40example.com", claims: adminClaims, headers: map[string]string{"If-Match": `"2"`}})
+	api.expect(resp, 204, nil)
+	if resp.Body != "" {
+		t.Errorf("DELETE body %q, want empty", resp.Body)
+	}
+	api.expect(api.do(apiRequest{method: "GET", path: "/users/jane%40example.com", claims: writerClaims}), 404, nil)
+
+	resp = api.do(apiRequest{method: "POST", path: "/users/jane%40example.com:restore", claims: adminClaims, headers: map[string]string{"If-Match": `"3"`}})
+	api.expect(resp, 200, &got)
+	if got.DeletedAt != "" || got.UpdatedBy != "admin-1" || resp.Headers["ETag"] != `"4"` {
+		t.Errorf("restore: %+v, headers %v", got, resp.Headers)
+	}
+
+	if p := api.pub; len(p.Published) != 1 || len(p.Updated) != 1 || len(p.Deleted) != 1 || len(p.Restored) != 1 {
+		t.Errorf("published created=%d updated=%d deleted=%d restored=%d, want one each", len(p.Published), len(p.Updated), len(p.Deleted), len(p.Restored))
+	}
+}
+
+func TestRouter_Errors(t *testing.T) {
+	api := newTestAPI(t)
+	tests := []struct {
+		name   string
+		req    apiRequest
+		status int
+		code   string
+	}{
+		{"missing sub", apiRequest{method: "GET", path: "/users", claims: map[string]string{"scope": "users:read"}}, 401, "missing_claim"},
+		{"no scope", apiRequest{method: "GET", path: "/users", claims: map[string]string{"sub": "u1"}}, 403, "forbidden"},
+		{"unknown route", apiRequest{method: "GET", path: "/accounts", claims: writerClaims}, 404, "route_not_found"},
+		{"wrong method", apiRequest{method: "PUT", path: "/users/u1", claims: writerClaims}, 405, "method_not_allowed"},
+		{"invalid JSON", apiRequest{method: "POST", path: "/users", claims: writerClaims, body: `{"id":`}, 400, "invalid_json"},
+		{"invalid fields", apiRequest{method: "POST", path: "/users", claims: writerClaims, body: `{"id":"me","email":"x","name":"X"}`}, 400, "validation_failed"},
+		{"invalid limit", apiRequest{method: "GET", path: "/users?limit=-1", claims: writerClaims}, 400, "validation_failed"},
+		{"bad escape in id", apiRequest{method: "GET", path: "/users/%zz", claims: writerClaims}, 404, "route_not_found"},
+		{"unknown user", apiRequest{method: "GET", path: "/users/nobody", claims: writerClaims}, 404, "user_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.t = t
+			resp := api.do(tt.req)
+			var p httpapi.ProblemDetails
+			api.expect(resp, tt.status, &p)
+			if p.Code != tt.code || p.Status != tt.status || p.Instance != "req-test" || resp.Headers["Content-Type"] != "application/problem+json" {
+				t.Errorf("problem %+v, headers %v", p, resp.Headers)
+			}
+		})
+	}
+}
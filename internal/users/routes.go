@@ -0,0 +1,49 @@
+package users
+
+import (
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/internal/authz"
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+)
+
+// responseMargin is the part of the Lambda time budget reserved for returning the response.
+const responseMargin = 500 * time.Millisecond
+
+// Scopes and the admin group/role checked by the route policies.
+const (
+	ScopeRead  = "users:read"
+	ScopeWrite = "users:write"
+	AdminRole  = "admin"
+)
+
+// Route policies. users:read and users:write grant access to any user; without them a caller may
+// only read and update the user whose id is their sub, or their own user through /users/me, which needs
+// no policy beyond authentication. Delete and restore are admin-only.
+var (
+	isAdmin  = authz.AnyOf(authz.Group(AdminRole), authz.Role(AdminRole))
+	canList  = authz.AnyOf(authz.Scope(ScopeRead), isAdmin)
+	canRead  = authz.AnyOf(authz.Scope(ScopeRead), isAdmin, authz.Self("id"))
+	canWrite = authz.AnyOf(authz.Scope(ScopeWrite), isAdmin)
+	canEdit  = authz.AnyOf(authz.Scope(ScopeWrite), isAdmin, authz.Self("id"))
+)
+
+// NewRouter returns the user API router with the standard middleware chain, all user routes and their
+// authorization policies. It is shared by the Lambda entry point and the local HTTP server.
+// tenantClaim names the JWT claim holding the caller's tenant; empty means a single-tenant deployment.
+func NewRouter(h *Handler, tenantClaim string) *httpapi.Router {
+	r := httpapi.NewRouter()
+	r.Use(httpapi.Logger(), httpapi.Timeout(responseMargin), httpapi.Recover(), httpapi.RequireClaim("sub"), Correlate())
+	if tenantClaim != "" {
+		r.Use(RequireTenant(tenantClaim))
+	}
+	r.Register("POST", "/users", h.CreateUser, authz.Require(canWrite))
+	r.Register("GET", "/users", h.ListUsers, authz.Require(canList))
+	r.Register("GET", "/users/me", h.GetMe)
+	r.Register("PATCH", "/users/me", h.UpdateMe)
+	r.Register("GET", "/users/{id}", h.GetUser, authz.Require(canRead))
+	r.Register("PATCH", "/users/{id}", h.UpdateUser, authz.Require(canEdit))
+	r.Register("DELETE", "/users/{id}", h.DeleteUser, authz.Require(isAdmin))
+	r.Register("POST", "/users/{id}:restore", h.RestoreUser, authz.Require(isAdmin))
+	return r
+}
@@ -2,20 +2,76 @@ package users
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 	"strings"
 	"time"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
 )
 
-// UserRepository defines persistence for users.
+// UserRepository defines persistence for users. Put writes the user and, if msg is non-nil,
+// the outbox message atomically; the OutboxStore methods drain those messages.
 type UserRepository interface {
-	Put(ctx context.Context, u *User) error
-	GetByID(ctx context.Context, id string) (*User, error)
+	OutboxStore
+	Put(ctx context.Context, u *User, msg *OutboxMessage) error
+	GetByID(ctx context.Context, id string, opts ...GetOption) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetBySubject(ctx context.Context, subject string) (*User, error)
+	Update(ctx context.Context, id string, upd UserUpdate, opts ...WriteOption) (*User, error)
+	SoftDelete(ctx context.Context, id, deletedAt, deletedBy string, opts ...WriteOption) error
+	Restore(ctx context.Context, id, restoredAt, restoredBy string, opts ...WriteOption) (*User, error)
+	List(ctx context.Context, opts ListOptions) (*UserPage, error)
+}
+
+// GetOptions controls how UserRepository.GetByID resolves a user.
+type GetOptions struct {
+	IncludeDeleted bool // return soft-deleted users instead of treating them as not found
+}
+
+// GetOption configures GetOptions.
+type GetOption func(*GetOptions)
+
+// IncludeDeleted makes GetByID return soft-deleted users.
+func IncludeDeleted() GetOption {
+	return func(o *GetOptions) { o.IncludeDeleted = true }
+}
+
+func applyGetOptions(opts []GetOption) GetOptions {
+	var o GetOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WriteOptions controls the preconditions of UserRepository.Update, SoftDelete and Restore.
+type WriteOptions struct {
+	IfVersion int64 // write only if the user is at this version; 0 writes unconditionally
+}
+
+// WriteOption configures WriteOptions.
+type WriteOption func(*WriteOptions)
+
+// IfVersion makes a write fail with ErrVersionMismatch unless the user is at version v.
+func IfVersion(v int64) WriteOption {
+	return func(o *WriteOptions) { o.IfVersion = v }
+}
+
+func applyWriteOptions(opts []WriteOption) WriteOptions {
+	var o WriteOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
 // EventPublisher publishes events (e.g. to SQS).
 type EventPublisher interface {
 	PublishUserCreated(ctx context.Context, payload UserCreatedEventPayload) error
+	PublishUserUpdated(ctx context.Context, payload UserUpdatedEventPayload) error
+	PublishUserDeleted(ctx context.Context, payload UserDeletedEventPayload) error
+	PublishUserRestored(ctx context.Context, payload UserRestoredEventPayload) error
 }
 
 // UserCreatedEventPayload is the data needed to publish UserCreated.
@@ -26,56 +82,235 @@ type UserCreatedEventPayload struct {
 	CreatedAt string
 	CreatedBy string
 	RequestID string
+	TenantID  string
+}
+
+// UserUpdatedEventPayload is the data needed to publish UserUpdated.
+type UserUpdatedEventPayload struct {
+	UserID        string
+	Email         string
+	Name          string
+	ChangedFields []string
+	UpdatedAt     string
+	UpdatedBy     string
+	RequestID     string
+	TenantID      string
+}
+
+// UserDeletedEventPayload is the data needed to publish UserDeleted.
+type UserDeletedEventPayload struct {
+	UserID    string
+	DeletedAt string
+	DeletedBy string
+	RequestID string
+	TenantID  string
+}
+
+// UserRestoredEventPayload is the data needed to publish UserRestored.
+type UserRestoredEventPayload struct {
+	UserID     string
+	RestoredAt string
+	RestoredBy string
+	RequestID  string
+	TenantID   string
 }
 
 // Service implements user management use cases.
 type Service struct {
-	repo     UserRepository
+	repo      UserRepository
 	publisher EventPublisher
+	relay     *OutboxRelay
 }
 
 // NewService returns a new Service.
 func NewService(repo UserRepository, publisher EventPublisher) *Service {
-	return &Service{repo: repo, publisher: publisher}
+	return &Service{repo: repo, publisher: publisher, relay: NewOutboxRelay(repo, publisher)}
 }
 
-// CreateUser creates a user and publishes an event. Returns the created user or a validation/domain error.
+// CreateUser creates a user and publishes an event. Returns the created user or an apperr validation/domain error.
+// The user.created event is stored in the outbox together with the user and delivered right away; if that
+// delivery fails, the message stays pending and is picked up by the outbox relay.
 func (s *Service) CreateUser(ctx context.Context, in CreateUserInput, createdBy string) (*User, error) {
-	if msg := ValidateCreateInput(&in); msg != "" {
-		return nil, fmt.Errorf("validation: %s", msg)
+	if errs := ValidateCreateInput(&in); len(errs) > 0 {
+		return nil, apperr.Invalid(errs...)
 	}
 	now := time.Now().UTC().Format(time.RFC3339)
 	u := &User{
 		ID:        strings.TrimSpace(in.ID),
 		Email:     strings.TrimSpace(in.Email),
 		Name:      strings.TrimSpace(in.Name),
+		Subject:   strings.TrimSpace(in.Subject),
 		CreatedAt: now,
 		CreatedBy: createdBy,
+		Version:   1,
 	}
-	if err := s.repo.Put(ctx, u); err != nil {
-		return nil, err
-	}
-	// Best-effort publish; do not fail the request if SQS fails
-	_ = s.publisher.PublishUserCreated(ctx, UserCreatedEventPayload{
+	msg, err := newOutboxMessage(ctx, events.UserCreatedEventType, UserCreatedEventPayload{
 		UserID:    u.ID,
 		Email:     u.Email,
 		Name:      u.Name,
 		CreatedAt: u.CreatedAt,
 		CreatedBy: u.CreatedBy,
 		RequestID: getRequestID(ctx),
+		TenantID:  getTenantID(ctx),
+	}, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Put(ctx, u, &msg); err != nil {
+		return nil, err
+	}
+	// Do not fail the request if SQS fails; the relay retries pending outbox messages
+	if err := s.relay.Deliver(ctx, msg); err != nil {
+		slog.Warn("user.created left in outbox", "outboxId", msg.ID, "userId", u.ID, "error", err)
+	}
+	return u, nil
+}
+
+// UpdateUser applies a partial update to a user and publishes an event listing the changed fields.
+// Returns ErrUserNotFound if the user does not exist and ErrVersionMismatch if IfVersion does not match.
+// If nothing changes, the user is returned as is and no event is published.
+func (s *Service) UpdateUser(ctx context.Context, id string, in UpdateUserInput, updatedBy string, opts ...WriteOption) (*User, error) {
+	if errs := ValidateUpdateInput(&in); len(errs) > 0 {
+		return nil, apperr.Invalid(errs...)
+	}
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrUserNotFound
+	}
+	if v := applyWriteOptions(opts).IfVersion; v != 0 && v != current.Version {
+		return nil, ErrVersionMismatch
+	}
+
+	var upd UserUpdate
+	var changed []string
+	if in.Email != nil {
+		if email := strings.TrimSpace(*in.Email); email != current.Email {
+			upd.Email = &email
+			changed = append(changed, "email")
+		}
+	}
+	if in.Name != nil {
+		if name := strings.TrimSpace(*in.Name); name != current.Name {
+			upd.Name = &name
+			changed = append(changed, "name")
+		}
+	}
+	if len(changed) == 0 {
+		return current, nil
+	}
+	upd.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	upd.UpdatedBy = updatedBy
+
+	u, err := s.repo.Update(ctx, id, upd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Best-effort publish; do not fail the request if SQS fails
+	_ = s.publisher.PublishUserUpdated(ctx, UserUpdatedEventPayload{
+		UserID:        u.ID,
+		Email:         u.Email,
+		Name:          u.Name,
+		ChangedFields: changed,
+		UpdatedAt:     u.UpdatedAt,
+		UpdatedBy:     u.UpdatedBy,
+		RequestID:     getRequestID(ctx),
+		TenantID:      getTenantID(ctx),
 	})
 	return u, nil
 }
 
-// GetUser returns a user by id or nil if not found.
-func (s *Service) GetUser(ctx context.Context, id string) (*User, error) {
-	return s.repo.GetByID(ctx, id)
+// GetUser returns a user by id or nil if not found. Deleted users are nil unless IncludeDeleted is passed.
+func (s *Service) GetUser(ctx context.Context, id string, opts ...GetOption) (*User, error) {
+	return s.repo.GetByID(ctx, id, opts...)
+}
+
+// GetUserByEmail returns the active user with the given email (compared after NormalizeEmail) or nil if none.
+func (s *Service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	if NormalizeEmail(email) == "" {
+		return nil, apperr.Invalid(apperr.FieldError{Field: "email", Code: fieldRequired, Message: "email must not be empty"})
+	}
+	return s.repo.GetByEmail(ctx, email)
+}
+
+// GetUserBySubject returns the active user linked to the JWT subject or nil if none.
+func (s *Service) GetUserBySubject(ctx context.Context, subject string) (*User, error) {
+	if subject == "" {
+		return nil, nil
+	}
+	return s.repo.GetBySubject(ctx, subject)
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+var errInvalidLimit = apperr.Invalid(apperr.FieldError{Field: "limit", Code: "out_of_range", Message: "limit must be a positive integer"})
+
+// ListUsers returns a page of active users ordered by creation time. A zero limit uses the default;
+// limits above the maximum are capped. Returns ErrInvalidCursor if the cursor was not issued by us.
+func (s *Service) ListUsers(ctx context.Context, opts ListOptions) (*UserPage, error) {
+	if opts.Limit < 0 {
+		return nil, errInvalidLimit
+	}
+	if opts.Limit == 0 {
+		opts.Limit = defaultListLimit
+	}
+	if opts.Limit > maxListLimit {
+		opts.Limit = maxListLimit
+	}
+	return s.repo.List(ctx, opts)
+}
+
+// DeleteUser soft-deletes a user and publishes an event. Returns ErrUserNotFound if the user
+// does not exist or is already deleted and ErrVersionMismatch if IfVersion does not match.
+func (s *Service) DeleteUser(ctx context.Context, id, deletedBy string, opts ...WriteOption) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.SoftDelete(ctx, id, now, deletedBy, opts...); err != nil {
+		return err
+	}
+	// Best-effort publish; do not fail the request if SQS fails
+	_ = s.publisher.PublishUserDeleted(ctx, UserDeletedEventPayload{
+		UserID:    id,
+		DeletedAt: now,
+		DeletedBy: deletedBy,
+		RequestID: getRequestID(ctx),
+		TenantID:  getTenantID(ctx),
+	})
+	return nil
+}
+
+// RestoreUser undoes a soft delete and publishes an event. Returns ErrUserNotFound if the user
+// does not exist, ErrUserNotDeleted if it is not deleted, ErrEmailInUse or ErrSubjectInUse if another user
+// took the email or subject meanwhile and ErrVersionMismatch if IfVersion does not match.
+func (s *Service) RestoreUser(ctx context.Context, id, restoredBy string, opts ...WriteOption) (*User, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	u, err := s.repo.Restore(ctx, id, now, restoredBy, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Best-effort publish; do not fail the request if SQS fails
+	_ = s.publisher.PublishUserRestored(ctx, UserRestoredEventPayload{
+		UserID:     u.ID,
+		RestoredAt: now,
+		RestoredBy: restoredBy,
+		RequestID:  getRequestID(ctx),
+		TenantID:   getTenantID(ctx),
+	})
+	return u, nil
 }
 
 // contextKey type for request-scoped values
 type contextKey string
 
-const requestIDKey contextKey = "requestId"
+const (
+	requestIDKey contextKey = "requestId"
+	tenantIDKey  contextKey = "tenantId"
+	metadataKey  contextKey = "eventMetadata"
+)
 
 // SetRequestID stores requestId in context.
 func SetRequestID(ctx context.Context, requestID string) context.Context {
@@ -87,4 +322,17 @@ func getRequestID(ctx context.Context) string {
 		return v
 	}
 	return ""
-}
\ No newline at end of file
+}
+
+// SetTenantID stores the caller's tenant in context. Repositories scope every key to it; an empty
+// tenant selects the single-tenant (unprefixed) keys.
+func SetTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, tenantID)
+}
+
+func getTenantID(ctx context.Context) string {
+	if v, ok := ctx.Value(tenantIDKey).(string); ok {
+		return v
+	}
+	return ""
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
 )
 
 func TestService_CreateUser(t *testing.T) {
@@ -111,3 +114,312 @@ func TestService_CreateUser_PublishErrorDoesNotFailRequest(t *testing.T) {
 		t.Error("user should be persisted even when SQS fails")
 	}
 }
+
+func strPtr(s string) *string { return &s }
+
+func TestService_UpdateUser(t *testing.T) {
+	ctx := SetRequestID(context.Background(), "req-3")
+	pub := NewMockPublisher()
+	svc := NewService(NewMockRepo(), pub)
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub-1"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	u, err := svc.UpdateUser(ctx, "u1", UpdateUserInput{Name: strPtr(" Alicia "), Email: strPtr("a@b.com")}, "sub-2")
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if u.Name != "Alicia" || u.Email != "a@b.com" || u.UpdatedBy != "sub-2" || u.UpdatedAt == "" {
+		t.Errorf("unexpected user: %+v", u)
+	}
+	if u.CreatedBy != "sub-1" {
+		t.Errorf("CreatedBy should be preserved, got %q", u.CreatedBy)
+	}
+	if len(pub.Updated) != 1 {
+		t.Fatalf("expected 1 updated event, got %d", len(pub.Updated))
+	}
+	ev := pub.Updated[0]
+	if ev.UserID != "u1" || len(ev.ChangedFields) != 1 || ev.ChangedFields[0] != "name" || ev.RequestID != "req-3" {
+		t.Errorf("unexpected payload: %+v", ev)
+	}
+
+	// No-op update: nothing changes, no event
+	if _, err := svc.UpdateUser(ctx, "u1", UpdateUserInput{Name: strPtr("Alicia")}, "sub-2"); err != nil {
+		t.Fatalf("no-op UpdateUser: %v", err)
+	}
+	if len(pub.Updated) != 1 {
+		t.Errorf("expected no event for no-op update, got %d", len(pub.Updated))
+	}
+}
+
+func TestService_UpdateUser_NotFoundAndValidation(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(NewMockRepo(), NewMockPublisher())
+
+	_, err := svc.UpdateUser(ctx, "missing", UpdateUserInput{Name: strPtr("X")}, "sub")
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	_, err = svc.UpdateUser(ctx, "u1", UpdateUserInput{}, "sub")
+	if err == nil || err.Error() != "validation: at least one of email or name is required" {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	_, err = svc.UpdateUser(ctx, "u1", UpdateUserInput{Email: strPtr("nope")}, "sub")
+	if err == nil || err.Error() != "validation: email must be a valid email address" {
+		t.Errorf("expected email validation error, got %v", err)
+	}
+}
+
+func TestService_DeleteAndRestoreUser(t *testing.T) {
+	ctx := SetRequestID(context.Background(), "req-4")
+	pub := NewMockPublisher()
+	svc := NewService(NewMockRepo(), pub)
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub-1"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := svc.DeleteUser(ctx, "u1", "admin"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if got, _ := svc.GetUser(ctx, "u1"); got != nil {
+		t.Errorf("deleted user should not be returned, got %+v", got)
+	}
+	got, err := svc.GetUser(ctx, "u1", IncludeDeleted())
+	if err != nil || got == nil || got.DeletedAt == "" || got.DeletedBy != "admin" {
+		t.Fatalf("GetUser(IncludeDeleted): got %+v, err %v", got, err)
+	}
+	if err := svc.DeleteUser(ctx, "u1", "admin"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("second delete: expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := svc.UpdateUser(ctx, "u1", UpdateUserInput{Name: strPtr("X")}, "sub-1"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("update deleted: expected ErrUserNotFound, got %v", err)
+	}
+	if len(pub.Deleted) != 1 || pub.Deleted[0].UserID != "u1" || pub.Deleted[0].RequestID != "req-4" {
+		t.Errorf("unexpected deleted events: %+v", pub.Deleted)
+	}
+
+	u, err := svc.RestoreUser(ctx, "u1", "admin")
+	if err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	if u.DeletedAt != "" || u.UpdatedBy != "admin" {
+		t.Errorf("unexpected restored user: %+v", u)
+	}
+	if got, _ := svc.GetUser(ctx, "u1"); got == nil {
+		t.Error("restored user should be returned")
+	}
+	if _, err := svc.RestoreUser(ctx, "u1", "admin"); !errors.Is(err, ErrUserNotDeleted) {
+		t.Errorf("restore active user: expected ErrUserNotDeleted, got %v", err)
+	}
+	if _, err := svc.RestoreUser(ctx, "missing", "admin"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("restore missing user: expected ErrUserNotFound, got %v", err)
+	}
+	if len(pub.Restored) != 1 || pub.Restored[0].RestoredBy != "admin" {
+		t.Errorf("unexpected restored events: %+v", pub.Restored)
+	}
+}
+
+func TestService_ListUsers_Paging(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockRepo()
+	svc := NewService(repo, NewMockPublisher())
+	// Same CreatedAt for all users: order falls back to ID.
+	for _, id := range []string{"u3", "u1", "u5", "u2", "u4"} {
+		if err := repo.Put(ctx, &User{ID: id, Email: id + "@b.com", Name: id, CreatedAt: "2024-01-01T00:00:00Z"}, nil); err != nil {
+			t.Fatalf("Put %s: %v", id, err)
+		}
+	}
+	if err := svc.DeleteUser(ctx, "u4", "admin"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	var ids []string
+	cursor := ""
+	pages := 0
+	for {
+		page, err := svc.ListUsers(ctx, ListOptions{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListUsers: %v", err)
+		}
+		pages++
+		for _, u := range page.Items {
+			ids = append(ids, u.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	want := []string{"u1", "u2", "u3", "u5"}
+	if pages != 2 || len(ids) != len(want) {
+		t.Fatalf("expected %v in 2 pages, got %v in %d pages", want, ids, pages)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("item %d: expected %s, got %s", i, want[i], ids[i])
+		}
+	}
+}
+
+func TestService_ListUsers_InvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockRepo()
+	svc := NewService(repo, NewMockPublisher())
+	for _, id := range []string{"u1", "u2"} {
+		if _, err := svc.CreateUser(ctx, CreateUserInput{ID: id, Email: id + "@b.com", Name: id}, "sub"); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	page, err := svc.ListUsers(ctx, ListOptions{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("ListUsers: page %+v, err %v", page, err)
+	}
+	tampered := "x" + page.NextCursor
+	if _, err := svc.ListUsers(ctx, ListOptions{Limit: 1, Cursor: tampered}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+	if _, err := svc.ListUsers(ctx, ListOptions{Limit: -1}); err == nil || err.Error() != "validation: limit must be a positive integer" {
+		t.Errorf("expected limit validation error, got %v", err)
+	}
+}
+
+func TestService_UniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(NewMockRepo(), NewMockPublisher())
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	_, err := svc.CreateUser(ctx, CreateUserInput{ID: "u2", Email: " A@B.com", Name: "Bob"}, "sub")
+	if !errors.Is(err, ErrEmailInUse) {
+		t.Fatalf("expected ErrEmailInUse for same normalized email, got %v", err)
+	}
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u2", Email: "c@d.com", Name: "Bob"}, "sub"); err != nil {
+		t.Fatalf("CreateUser u2: %v", err)
+	}
+
+	// Changing email moves the reservation
+	if _, err := svc.UpdateUser(ctx, "u2", UpdateUserInput{Email: strPtr("a@b.com")}, "sub"); !errors.Is(err, ErrEmailInUse) {
+		t.Errorf("expected ErrEmailInUse on update, got %v", err)
+	}
+	if _, err := svc.UpdateUser(ctx, "u1", UpdateUserInput{Email: strPtr("new@b.com")}, "sub"); err != nil {
+		t.Fatalf("UpdateUser u1: %v", err)
+	}
+	if _, err := svc.UpdateUser(ctx, "u2", UpdateUserInput{Email: strPtr("a@b.com")}, "sub"); err != nil {
+		t.Errorf("old email should be released, got %v", err)
+	}
+
+	// Deleting releases the email; restoring fails while someone else holds it
+	if err := svc.DeleteUser(ctx, "u1", "admin"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u3", Email: "new@b.com", Name: "Carol"}, "sub"); err != nil {
+		t.Fatalf("email of deleted user should be free: %v", err)
+	}
+	if _, err := svc.RestoreUser(ctx, "u1", "admin"); !errors.Is(err, ErrEmailInUse) {
+		t.Errorf("expected ErrEmailInUse on restore, got %v", err)
+	}
+}
+
+func TestService_GetUserByEmail(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(NewMockRepo(), NewMockPublisher())
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "Alice@Example.com", Name: "Alice"}, "sub"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u, err := svc.GetUserByEmail(ctx, "  alice@EXAMPLE.com ")
+	if err != nil || u == nil || u.ID != "u1" {
+		t.Fatalf("GetUserByEmail: got %+v, err %v", u, err)
+	}
+	if u.Email != "Alice@Example.com" {
+		t.Errorf("stored email should keep its original casing, got %q", u.Email)
+	}
+	if err := svc.DeleteUser(ctx, "u1", "admin"); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if u, err := svc.GetUserByEmail(ctx, "alice@example.com"); err != nil || u != nil {
+		t.Errorf("deleted user should not be found, got %+v, err %v", u, err)
+	}
+	if _, err := svc.GetUserByEmail(ctx, " "); err == nil {
+		t.Error("expected validation error for empty email")
+	}
+}
+
+func TestService_CreateUser_OutboxRelayDeliversAfterPublishFailure(t *testing.T) {
+	ctx := SetRequestID(context.Background(), "req-5")
+	repo := NewMockRepo()
+	pub := NewMockPublisher()
+	pub.PublishError = errors.New("SQS unavailable")
+	svc := NewService(repo, pub)
+
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub-1"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	pending, _ := repo.ListPendingOutbox(ctx, 10)
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending outbox message after failed publish, got %d", len(pending))
+	}
+
+	relay := NewOutboxRelay(repo, pub)
+	if _, err := relay.Sweep(ctx, 10); err == nil {
+		t.Error("expected sweep error while SQS is down")
+	}
+	pub.PublishError = nil
+	delivered, err := relay.Sweep(ctx, 10)
+	if err != nil || delivered != 1 {
+		t.Fatalf("Sweep: delivered %d, err %v", delivered, err)
+	}
+	last := pub.Published[len(pub.Published)-1]
+	if last.UserID != "u1" || last.RequestID != "req-5" {
+		t.Errorf("unexpected relayed payload: %+v", last)
+	}
+	if pending, _ := repo.ListPendingOutbox(ctx, 10); len(pending) != 0 {
+		t.Errorf("expected no pending messages after sweep, got %d", len(pending))
+	}
+}
+
+func TestService_CreateUser_OutboxMarkedSentOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMockRepo()
+	svc := NewService(repo, NewMockPublisher())
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub-1"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if pending, _ := repo.ListPendingOutbox(ctx, 10); len(pending) != 0 {
+		t.Errorf("expected outbox message to be marked sent, got %d pending", len(pending))
+	}
+}
+
+func TestService_CreateUser_OutboxKeepsEventMetadata(t *testing.T) {
+	ctx := WithEventMetadata(SetRequestID(context.Background(), "req-6"), events.Metadata{CorrelationID: "corr-6"})
+	repo := NewMockRepo()
+	client := &fakeSQS{err: errors.New("SQS unavailable")}
+	svc := NewService(repo, NewSQSPublisher(client, "q"))
+	if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: "Alice"}, "sub-1"); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	pending, _ := repo.ListPendingOutbox(ctx, 10)
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending outbox message, got %d", len(pending))
+	}
+
+	// The relay runs without the request's context, yet redelivers the same event
+	client.err = nil
+	if _, err := NewOutboxRelay(repo, NewSQSPublisher(client, "q")).Sweep(context.Background(), 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.inputs) != 2 {
+		t.Fatalf("expected 2 sends, got %d", len(client.inputs))
+	}
+	for _, in := range client.inputs {
+		env, err := events.DecodeEnvelope([]byte(aws.ToString(in.MessageBody)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.EventID != pending[0].ID || env.CorrelationID != "corr-6" || env.CausationID != "req-6" {
+			t.Errorf("metadata %+v, want event id %s, correlation corr-6 and causation req-6", env.Metadata, pending[0].ID)
+		}
+		if env.OccurredAt != pending[0].CreatedAt {
+			t.Errorf("occurredAt %s, want the write time %s", env.OccurredAt, pending[0].CreatedAt)
+		}
+	}
+}
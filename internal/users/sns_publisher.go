@@ -0,0 +1,81 @@
+package users
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SNSAPI is the part of the SNS client used by SNSPublisher.
+type SNSAPI interface {
+	Publish(ctx context.Context, in *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNSPublisher publishes user events to an SNS topic, fanning them out to every subscriber.
+// The message is the envelope JSON; its type, version, tenant and metadata are also sent as message
+// attributes so subscription filter policies can match without parsing the body.
+type SNSPublisher struct {
+	client   SNSAPI
+	topicARN string
+	source   string
+}
+
+// NewSNSPublisher returns an SNSPublisher for the topic topicARN and events from source.
+func NewSNSPublisher(client SNSAPI, topicARN, source string) *SNSPublisher {
+	return &SNSPublisher{client: client, topicARN: topicARN, source: source}
+}
+
+// PublishUserCreated publishes a UserCreated event to the topic.
+func (p *SNSPublisher) PublishUserCreated(ctx context.Context, payload UserCreatedEventPayload) error {
+	return p.send(ctx, userCreatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserUpdated publishes a UserUpdated event to the topic.
+func (p *SNSPublisher) PublishUserUpdated(ctx context.Context, payload UserUpdatedEventPayload) error {
+	return p.send(ctx, userUpdatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserDeleted publishes a UserDeleted event to the topic.
+func (p *SNSPublisher) PublishUserDeleted(ctx context.Context, payload UserDeletedEventPayload) error {
+	return p.send(ctx, userDeletedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserRestored publishes a UserRestored event to the topic.
+func (p *SNSPublisher) PublishUserRestored(ctx context.Context, payload UserRestoredEventPayload) error {
+	return p.send(ctx, userRestoredEnvelope(payload), payload.UserID)
+}
+
+func (p *SNSPublisher) send(ctx context.Context, ev events.Envelope, userID string) error {
+	ev, err := withMetadata(ctx, ev, p.source)
+	if err != nil {
+		return err
+	}
+	body, err := events.MarshalEnvelope(ev)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+	attrs := make(map[string]snstypes.MessageAttributeValue)
+	for name, v := range envelopeAttributes(ev) {
+		attrs[name] = stringAttribute(v)
+	}
+	_, err = p.client.Publish(ctx, &sns.PublishInput{
+		TopicArn:          &p.topicARN,
+		Message:           aws.String(string(body)),
+		MessageAttributes: attrs,
+	})
+	if err != nil {
+		slog.Error("SNS publish failed", "error", err, "eventType", ev.EventType)
+		return err
+	}
+	slog.Info("SNS publish success", "eventType", ev.EventType, "eventId", ev.EventID, "userId", userID)
+	return nil
+}
+
+func stringAttribute(v string) snstypes.MessageAttributeValue {
+	return snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+}
@@ -2,49 +2,140 @@ package users
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
-	"time"
 
 	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
 )
 
+// MessageFormat is the encoding of the events sent by SQSPublisher.
+type MessageFormat string
+
+// Message formats accepted by WithMessageFormat.
+const (
+	// FormatEnvelope sends the events.Envelope JSON as the body.
+	FormatEnvelope MessageFormat = "envelope"
+	// FormatCloudEvents sends a structured-mode CloudEvent (the whole event as JSON) as the body.
+	FormatCloudEvents MessageFormat = "cloudevents"
+	// FormatCloudEventsBinary sends the CloudEvent data as the body and its attributes as message attributes.
+	FormatCloudEventsBinary MessageFormat = "cloudevents-binary"
+)
+
+// SQSPublisherOption configures an SQSPublisher.
+type SQSPublisherOption func(*SQSPublisher)
+
+// WithMessageFormat sets the encoding of the messages; CloudEvents formats use source as the event
+// source. The default is FormatEnvelope.
+func WithMessageFormat(format MessageFormat, source string) SQSPublisherOption {
+	return func(p *SQSPublisher) {
+		p.format = format
+		p.source = source
+	}
+}
+
+// SQSAPI is the part of the SQS client used by SQSPublisher.
+type SQSAPI interface {
+	SendMessage(ctx context.Context, in *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
 // SQSPublisher publishes user events to SQS.
 type SQSPublisher struct {
-	client   *sqs.Client
+	client   SQSAPI
 	queueURL string
+	format   MessageFormat
+	source   string // CloudEvents source
 }
 
 // NewSQSPublisher returns an SQSPublisher.
-func NewSQSPublisher(client *sqs.Client, queueURL string) *SQSPublisher {
-	return &SQSPublisher{client: client, queueURL: queueURL}
+func NewSQSPublisher(client SQSAPI, queueURL string, opts ...SQSPublisherOption) *SQSPublisher {
+	p := &SQSPublisher{client: client, queueURL: queueURL, format: FormatEnvelope, source: DefaultEventSource}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // PublishUserCreated sends a UserCreated event to SQS.
 func (p *SQSPublisher) PublishUserCreated(ctx context.Context, payload UserCreatedEventPayload) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-	ev := events.NewUserCreatedEnvelope(now, events.UserCreatedV1{
-		UserID:    payload.UserID,
-		Email:     payload.Email,
-		Name:      payload.Name,
-		CreatedAt: payload.CreatedAt,
-		CreatedBy: payload.CreatedBy,
-		RequestID: payload.RequestID,
-	})
-	body, err := events.MarshalEnvelope(ev)
+	return p.send(ctx, userCreatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserUpdated sends a UserUpdated event to SQS.
+func (p *SQSPublisher) PublishUserUpdated(ctx context.Context, payload UserUpdatedEventPayload) error {
+	return p.send(ctx, userUpdatedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserDeleted sends a UserDeleted event to SQS.
+func (p *SQSPublisher) PublishUserDeleted(ctx context.Context, payload UserDeletedEventPayload) error {
+	return p.send(ctx, userDeletedEnvelope(payload), payload.UserID)
+}
+
+// PublishUserRestored sends a UserRestored event to SQS.
+func (p *SQSPublisher) PublishUserRestored(ctx context.Context, payload UserRestoredEventPayload) error {
+	return p.send(ctx, userRestoredEnvelope(payload), payload.UserID)
+}
+
+func (p *SQSPublisher) send(ctx context.Context, ev events.Envelope, userID string) error {
+	ev, err := withMetadata(ctx, ev, p.source)
+	if err != nil {
+		return err
+	}
+	in, err := p.message(ev)
 	if err != nil {
-		return fmt.Errorf("marshal envelope: %w", err)
+		return err
 	}
-	bodyStr := string(body)
-	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    &p.queueURL,
-		MessageBody: &bodyStr,
-	})
+	_, err = p.client.SendMessage(ctx, in)
 	if err != nil {
-		slog.Error("SQS publish failed", "error", err, "eventType", events.UserCreatedEventType)
+		slog.Error("SQS publish failed", "error", err, "eventType", ev.EventType)
 		return err
 	}
-	slog.Info("SQS publish success", "eventType", events.UserCreatedEventType, "userId", payload.UserID)
+	slog.Info("SQS publish success", "eventType", ev.EventType, "eventId", ev.EventID, "userId", userID)
 	return nil
 }
+
+// message encodes ev in the configured format. The envelope format mirrors the envelope metadata
+// into message attributes (see envelopeAttributes).
+func (p *SQSPublisher) message(ev events.Envelope) (*sqs.SendMessageInput, error) {
+	in := &sqs.SendMessageInput{QueueUrl: &p.queueURL}
+	if p.format == FormatEnvelope {
+		body, err := events.MarshalEnvelope(ev)
+		if err != nil {
+			return nil, fmt.Errorf("marshal envelope: %w", err)
+		}
+		in.MessageBody = aws.String(string(body))
+		in.MessageAttributes = sqsAttributes(envelopeAttributes(ev))
+		return in, nil
+	}
+	ce, err := events.NewCloudEvent(ev, p.source)
+	if err != nil {
+		return nil, err
+	}
+	if p.format == FormatCloudEventsBinary {
+		attrs := ce.BinaryAttributes()
+		// SQS allows at most 10 message attributes. The content type (always JSON) and dataschema
+		// (derived from type and version) are optional and left out to make room for the metadata.
+		delete(attrs, events.CloudEventsBinaryContentType)
+		delete(attrs, events.CloudEventsBinaryPrefix+"dataschema")
+		in.MessageBody = aws.String(string(ce.Data))
+		in.MessageAttributes = sqsAttributes(attrs)
+		return in, nil
+	}
+	body, err := json.Marshal(ce)
+	if err != nil {
+		return nil, fmt.Errorf("marshal CloudEvent: %w", err)
+	}
+	in.MessageBody = aws.String(string(body))
+	return in, nil
+}
+
+func sqsAttributes(attrs map[string]string) map[string]sqstypes.MessageAttributeValue {
+	out := make(map[string]sqstypes.MessageAttributeValue, len(attrs))
+	for name, v := range attrs {
+		out[name] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+	}
+	return out
+}
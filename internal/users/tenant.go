@@ -0,0 +1,51 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+	"github.com/JulianEZT/serverless-user-service/internal/httpapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// tenantPKPrefix starts the partition key of every item owned by a tenant: TENANT#<tenant>#USER#<id>.
+const tenantPKPrefix = "TENANT#"
+
+// tenantRegex restricts tenant ids so they cannot contain the "#" key delimiter.
+var tenantRegex = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	errTenantMissing = apperr.Forbidden("tenant_missing", "the token has no tenant")
+	errTenantInvalid = apperr.Forbidden("tenant_invalid", "the token's tenant is not a valid tenant id")
+)
+
+// tenantPrefix returns the key prefix for the tenant in ctx, or "" without a tenant.
+func tenantPrefix(ctx context.Context) string {
+	if t := getTenantID(ctx); t != "" {
+		return tenantPKPrefix + t + "#"
+	}
+	return ""
+}
+
+// RequireTenant is a middleware that reads the caller's tenant from the JWT claim and stores it with
+// SetTenantID, so every repository call of the request is scoped to that tenant. Requests without the
+// claim, or with a value that is not a valid tenant id, get 403.
+func RequireTenant(claim string) httpapi.Middleware {
+	return func(next httpapi.Handler) httpapi.Handler {
+		return func(ctx context.Context, req *httpapi.Request) (events.APIGatewayV2HTTPResponse, error) {
+			requestID := req.RequestContext.RequestID
+			tenant := req.Claim(claim)
+			if tenant == "" {
+				slog.Warn("missing tenant claim", "requestId", requestID, "claim", claim)
+				return httpapi.Problem(errTenantMissing, requestID), nil
+			}
+			if !tenantRegex.MatchString(tenant) {
+				slog.Warn("invalid tenant claim", "requestId", requestID, "claim", claim)
+				return httpapi.Problem(errTenantInvalid, requestID), nil
+			}
+			return next(SetTenantID(ctx, tenant), req)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestMockRepo_TenantIsolation(t *testing.T) {
+	repo := NewMockRepo()
+	pub := NewMockPublisher()
+	svc := NewService(repo, pub)
+	acme := SetTenantID(context.Background(), "acme")
+	globex := SetTenantID(context.Background(), "globex")
+
+	// The same id and email can exist once per tenant
+	for _, ctx := range []context.Context{acme, globex} {
+		if _, err := svc.CreateUser(ctx, CreateUserInput{ID: "u1", Email: "a@b.com", Name: getTenantID(ctx), Subject: "s1"}, "sub"); err != nil {
+			t.Fatalf("create in %s: %v", getTenantID(ctx), err)
+		}
+	}
+	if _, err := svc.CreateUser(acme, CreateUserInput{ID: "u2", Email: "c@d.com", Name: "Other"}, "sub"); err != nil {
+		t.Fatal(err)
+	}
+
+	if u, _ := svc.GetUser(globex, "u1"); u == nil || u.Name != "globex" {
+		t.Errorf("globex u1 = %+v", u)
+	}
+	if u, _ := svc.GetUser(globex, "u2"); u != nil {
+		t.Errorf("globex must not see acme's u2, got %+v", u)
+	}
+	if u, _ := svc.GetUser(context.Background(), "u1"); u != nil {
+		t.Errorf("no tenant must not see tenant users, got %+v", u)
+	}
+	if u, _ := svc.GetUserByEmail(globex, "c@d.com"); u != nil {
+		t.Errorf("globex email lookup leaked %+v", u)
+	}
+	if u, _ := svc.GetUserBySubject(acme, "s1"); u == nil || u.Name != "acme" {
+		t.Errorf("acme subject lookup = %+v", u)
+	}
+
+	page, err := svc.ListUsers(acme, ListOptions{Limit: 1})
+	if err != nil || len(page.Items) != 1 || page.NextCursor == "" {
+		t.Fatalf("acme list: %+v, %v", page, err)
+	}
+	if _, err := svc.ListUsers(globex, ListOptions{Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("another tenant's cursor: expected ErrInvalidCursor, got %v", err)
+	}
+	if page, _ := svc.ListUsers(globex, ListOptions{}); len(page.Items) != 1 {
+		t.Errorf("globex list = %d users, want 1", len(page.Items))
+	}
+
+	if _, err := svc.UpdateUser(globex, "u2", UpdateUserInput{Name: strPtr("X")}, "sub"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("cross-tenant update: expected ErrUserNotFound, got %v", err)
+	}
+	if err := svc.DeleteUser(globex, "u2", "sub"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("cross-tenant delete: expected ErrUserNotFound, got %v", err)
+	}
+	if err := svc.DeleteUser(acme, "u1", "sub"); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := svc.GetUser(globex, "u1"); u == nil || u.DeletedAt != "" {
+		t.Errorf("deleting acme's u1 affected globex: %+v", u)
+	}
+
+	if len(pub.Published) != 3 || pub.Published[0].TenantID != "acme" || pub.Published[1].TenantID != "globex" {
+		t.Errorf("created events = %+v", pub.Published)
+	}
+	if len(pub.Deleted) != 1 || pub.Deleted[0].TenantID != "acme" {
+		t.Errorf("deleted events = %+v", pub.Deleted)
+	}
+}
+
+func TestRequireTenant(t *testing.T) {
+	svc := NewService(NewMockRepo(), NewMockPublisher())
+	router := NewRouter(NewHandler(svc, nil), "custom:tenant_id")
+	call := func(claims map[string]string) events.APIGatewayV2HTTPResponse {
+		req := apiRequest{method: "POST", path: "/users", body: `{"id":"u1","email":"a@b.com","name":"A"}`, claims: claims}
+		resp, err := router.Handle(context.Background(), req.event())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	admin := func(tenant string) map[string]string {
+		c := map[string]string{"sub": "s1", "cognito:groups": "[admin]"}
+		if tenant != "" {
+			c["custom:tenant_id"] = tenant
+		}
+		return c
+	}
+
+	if resp := call(admin("")); resp.StatusCode != 403 {
+		t.Errorf("missing tenant: status %d, want 403", resp.StatusCode)
+	}
+	if resp := call(admin("a#b")); resp.StatusCode != 403 {
+		t.Errorf("invalid tenant: status %d, want 403", resp.StatusCode)
+	}
+	if resp := call(admin("acme")); resp.StatusCode != 201 {
+		t.Fatalf("create in acme: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	if resp := call(admin("globex")); resp.StatusCode != 201 {
+		t.Errorf("same id in globex: status %d, body %s", resp.StatusCode, resp.Body)
+	}
+	if u, _ := svc.GetUser(SetTenantID(context.Background(), "acme"), "u1"); u == nil {
+		t.Error("user not stored under the caller's tenant")
+	}
+}
@@ -1,32 +1,153 @@
 package users
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
 )
 
 // Email format: simple check for something@something.tld
 var emailRegex = regexp.MustCompile(`^[^@]+@[^@]+\.[^@]+$`)
 
-// ValidateCreateInput validates CreateUserInput. Returns a human-readable error message or empty string.
-func ValidateCreateInput(in *CreateUserInput) string {
-	if in == nil {
-		return "request body is required"
+// idRegex lists the characters allowed in a user id. "#" is the DynamoDB key delimiter, and "/" and ":"
+// are reserved by the routes (e.g. "/users/{id}:restore").
+var idRegex = regexp.MustCompile(`^[A-Za-z0-9._@-]+$`)
+
+// Field limits, counted in characters.
+const (
+	maxIDLength         = 64
+	maxEmailLength      = 254 // longest address usable in SMTP (RFC 5321)
+	maxEmailLocalLength = 64
+	maxNameLength       = 200
+	maxSubjectLength    = 128
+)
+
+// meID is the path segment of the /users/me routes, so it cannot be used as a user id.
+const meID = "me"
+
+// Field error codes returned in apperr.FieldError.Code.
+const (
+	fieldRequired      = "required"
+	fieldTooLong       = "too_long"
+	fieldInvalidChars  = "invalid_characters"
+	fieldInvalidFormat = "invalid_format"
+	fieldReserved      = "reserved"
+)
+
+// fieldRule checks a trimmed, non-empty field value. It returns the error code and message, or "" if the value is valid.
+type fieldRule func(field, value string) (code, message string)
+
+// userFieldRules are the rules for each user field, shared by create and update. Every field
+// reports only its first failing rule. Whether a field may be absent is decided by the caller.
+var userFieldRules = map[string][]fieldRule{
+	"id":      {maxLength(maxIDLength), idChars, notReserved(meID)},
+	"email":   {maxLength(maxEmailLength), normalizedEmail},
+	"name":    {maxLength(maxNameLength), printable},
+	"subject": {maxLength(maxSubjectLength), printable},
+}
+
+func maxLength(n int) fieldRule {
+	return func(field, value string) (string, string) {
+		if utf8.RuneCountInString(value) > n {
+			return fieldTooLong, fmt.Sprintf("%s must be at most %d characters", field, n)
+		}
+		return "", ""
+	}
+}
+
+func idChars(field, value string) (string, string) {
+	if !idRegex.MatchString(value) {
+		return fieldInvalidChars, field + " may only contain letters, digits, '.', '_', '@' and '-'"
+	}
+	return "", ""
+}
+
+func notReserved(word string) fieldRule {
+	return func(field, value string) (string, string) {
+		if value == word {
+			return fieldReserved, fmt.Sprintf("%s must not be %q", field, word)
+		}
+		return "", ""
+	}
+}
+
+// normalizedEmail validates the email in the form used for uniqueness (see NormalizeEmail), so two
+// addresses that normalize to the same key pass or fail together.
+func normalizedEmail(field, value string) (string, string) {
+	email := NormalizeEmail(value)
+	if strings.IndexFunc(email, unicode.IsSpace) >= 0 || !emailRegex.MatchString(email) {
+		return fieldInvalidFormat, field + " must be a valid email address"
+	}
+	if local := email[:strings.LastIndex(email, "@")]; utf8.RuneCountInString(local) > maxEmailLocalLength {
+		return fieldTooLong, fmt.Sprintf("%s must have at most %d characters before the @", field, maxEmailLocalLength)
+	}
+	return "", ""
+}
+
+func printable(field, value string) (string, string) {
+	if strings.IndexFunc(value, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return fieldInvalidChars, field + " must not contain control characters"
+	}
+	return "", ""
+}
+
+// checkField applies the rules for field to value and appends the first violation to errs.
+// A nil value is skipped unless required; a blank value is always a violation.
+func checkField(errs []apperr.FieldError, field string, value *string, required bool) []apperr.FieldError {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		switch {
+		case required:
+			return append(errs, apperr.FieldError{Field: field, Code: fieldRequired, Message: field + " is required"})
+		case value != nil:
+			return append(errs, apperr.FieldError{Field: field, Code: fieldRequired, Message: field + " must not be empty"})
+		}
+		return errs
 	}
-	id := strings.TrimSpace(in.ID)
-	if id == "" {
-		return "id is required"
+	v := strings.TrimSpace(*value)
+	for _, rule := range userFieldRules[field] {
+		if code, msg := rule(field, v); code != "" {
+			return append(errs, apperr.FieldError{Field: field, Code: code, Message: msg})
+		}
 	}
-	email := strings.TrimSpace(in.Email)
-	if email == "" {
-		return "email is required"
+	return errs
+}
+
+// NormalizeEmail returns the canonical form of an email used for uniqueness checks (trimmed, lowercased).
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateCreateInput validates CreateUserInput. Returns one FieldError per invalid field, or nil.
+func ValidateCreateInput(in *CreateUserInput) []apperr.FieldError {
+	if in == nil {
+		return []apperr.FieldError{{Field: "", Code: fieldRequired, Message: "request body is required"}}
 	}
-	if !emailRegex.MatchString(email) {
-		return "email must be a valid email address"
+	return validateCreate(in)
+}
+
+func validateCreate(in *CreateUserInput) []apperr.FieldError {
+	var errs []apperr.FieldError
+	errs = checkField(errs, "id", &in.ID, true)
+	errs = checkField(errs, "email", &in.Email, true)
+	errs = checkField(errs, "name", &in.Name, true)
+	if in.Subject != "" {
+		errs = checkField(errs, "subject", &in.Subject, false)
 	}
-	name := strings.TrimSpace(in.Name)
-	if name == "" {
-		return "name is required"
+	return errs
+}
+
+// ValidateUpdateInput validates UpdateUserInput. At least one field must be present and
+// present fields follow the same rules as on create. Returns one FieldError per invalid field, or nil.
+func ValidateUpdateInput(in *UpdateUserInput) []apperr.FieldError {
+	if in == nil || (in.Email == nil && in.Name == nil) {
+		return []apperr.FieldError{{Field: "", Code: fieldRequired, Message: "at least one of email or name is required"}}
 	}
-	return ""
+	var errs []apperr.FieldError
+	errs = checkField(errs, "email", in.Email, false)
+	errs = checkField(errs, "name", in.Name, false)
+	return errs
 }
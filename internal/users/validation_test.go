@@ -0,0 +1,62 @@
+package users
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/internal/apperr"
+)
+
+func TestValidateCreateInput_ReportsEveryField(t *testing.T) {
+	errs := ValidateCreateInput(&CreateUserInput{
+		ID:    "a/b:restore",
+		Email: strings.Repeat("x", 65) + "@example.com",
+		Name:  "bad\x00name",
+	})
+	want := []apperr.FieldError{
+		{Field: "id", Code: "invalid_characters", Message: "id may only contain letters, digits, '.', '_', '@' and '-'"},
+		{Field: "email", Code: "too_long", Message: "email must have at most 64 characters before the @"},
+		{Field: "name", Code: "invalid_characters", Message: "name must not contain control characters"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got %+v\nwant %+v", errs, want)
+	}
+}
+
+func TestValidateCreateInput_Rules(t *testing.T) {
+	tests := []struct {
+		in    CreateUserInput
+		field string
+		code  string
+	}{
+		{CreateUserInput{ID: "u1", Email: "A@Example.COM ", Name: "Ann"}, "", ""},
+		{CreateUserInput{ID: "  ", Email: "a@b.com", Name: "Ann"}, "id", "required"},
+		{CreateUserInput{ID: strings.Repeat("u", 65), Email: "a@b.com", Name: "Ann"}, "id", "too_long"},
+		{CreateUserInput{ID: "USER#1", Email: "a@b.com", Name: "Ann"}, "id", "invalid_characters"},
+		{CreateUserInput{ID: "u1", Email: "a b@c.com", Name: "Ann"}, "email", "invalid_format"},
+		{CreateUserInput{ID: "u1", Email: strings.Repeat("a", 250) + "@b.com", Name: "Ann"}, "email", "too_long"},
+		{CreateUserInput{ID: "u1", Email: "a@b.com", Name: strings.Repeat("é", 201)}, "name", "too_long"},
+	}
+	for _, tt := range tests {
+		errs := ValidateCreateInput(&tt.in)
+		if tt.field == "" {
+			if len(errs) != 0 {
+				t.Errorf("%+v: unexpected errors %+v", tt.in, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || errs[0].Field != tt.field || errs[0].Code != tt.code {
+			t.Errorf("%+v: got %+v, want %s/%s", tt.in, errs, tt.field, tt.code)
+		}
+	}
+}
+
+func TestValidateUpdateInput_UsesCreateRules(t *testing.T) {
+	long := strings.Repeat("n", 201)
+	empty := ""
+	errs := ValidateUpdateInput(&UpdateUserInput{Email: &empty, Name: &long})
+	if len(errs) != 2 || errs[0].Code != "required" || errs[0].Message != "email must not be empty" || errs[1].Code != "too_long" {
+		t.Errorf("unexpected errors %+v", errs)
+	}
+}
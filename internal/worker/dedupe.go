@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// Processing states recorded by a DedupeStore.
+const (
+	StatusInProgress = "in_progress"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+)
+
+const (
+	// dedupeLease is how long a claim blocks other deliveries of the event when the context has no
+	// deadline. It covers the longest Lambda run.
+	dedupeLease = 15 * time.Minute
+	// dedupeLeaseMargin is added to the invocation deadline so a claim outlives the handler by a little
+	// but not much: redeliveries of an event whose consumer crashed can claim it again soon after.
+	dedupeLeaseMargin = 30 * time.Second
+	// dedupeTTL is how long processed events are remembered; it matches the longest SQS retention,
+	// after which no redelivery can arrive.
+	dedupeTTL = 14 * 24 * time.Hour
+)
+
+var (
+	// ErrAlreadyProcessed is returned by DedupeStore.Claim when the event was processed before.
+	ErrAlreadyProcessed = errors.New("event already processed")
+	// ErrEventInProgress is returned by DedupeStore.Claim when another delivery of the event holds a live claim.
+	ErrEventInProgress = errors.New("event is being processed")
+	// ErrClaimLost is returned by DedupeStore.MarkProcessed and MarkFailed when the claim expired and
+	// another delivery claimed the event; the record then belongs to that delivery and is left alone.
+	ErrClaimLost = errors.New("event claim lost")
+)
+
+// DedupeStore records which events have been processed, keyed by envelope event id, so redeliveries
+// of an event are skipped. Records expire after dedupeTTL.
+type DedupeStore interface {
+	// Claim marks eventID in progress for lease and returns a token identifying the claim. It returns
+	// ErrAlreadyProcessed if the event was processed and ErrEventInProgress if another claim is live;
+	// failed events and expired claims can be claimed again.
+	Claim(ctx context.Context, eventID, eventType string, lease time.Duration) (token string, err error)
+	// MarkProcessed records that eventID was processed successfully, or returns ErrClaimLost if token
+	// is no longer the current claim.
+	MarkProcessed(ctx context.Context, eventID, token string) error
+	// MarkFailed records that processing eventID failed with cause, releasing the claim for a retry,
+	// or returns ErrClaimLost if token is no longer the current claim.
+	MarkFailed(ctx context.Context, eventID, token string, cause error) error
+}
+
+// Dedupe is a middleware that runs each event at most once successfully: it claims the event in store
+// before calling the handler, skips events already processed and records the outcome. An event in
+// progress elsewhere returns ErrEventInProgress, so SQS redelivers it once the visibility timeout
+// passes. A claim lasts until the invocation deadline plus dedupeLeaseMargin, so an event whose
+// consumer crashed is retried on the next delivery instead of running out its receives and landing in
+// the DLQ. Events without an event id (published before ids existed) are handled without dedupe.
+func Dedupe(store DedupeStore) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, env events.RawEnvelope) error {
+			if env.EventID == "" {
+				slog.Warn("event without id, not deduplicated", "eventType", env.EventType)
+				return next(ctx, env)
+			}
+			token, err := store.Claim(ctx, env.EventID, env.EventType, claimLease(ctx))
+			if err != nil {
+				if errors.Is(err, ErrAlreadyProcessed) {
+					slog.Info("duplicate event skipped", "eventId", env.EventID, "eventType", env.EventType)
+					return nil
+				}
+				return fmt.Errorf("claim event %s: %w", env.EventID, err)
+			}
+			if err := next(ctx, env); err != nil {
+				if markErr := store.MarkFailed(ctx, env.EventID, token, err); markErr != nil {
+					logMarkError("mark event failed", env.EventID, markErr)
+				}
+				return err
+			}
+			// The handler's work is done; on error the claim expires with its lease and a later
+			// redelivery runs the handler again, which is no worse than without dedupe.
+			if err := store.MarkProcessed(ctx, env.EventID, token); err != nil {
+				logMarkError("mark event processed", env.EventID, err)
+			}
+			return nil
+		}
+	}
+}
+
+// logMarkError logs a failed MarkProcessed or MarkFailed. A lost claim is expected when a handler
+// outran its lease: the delivery that re-claimed the event records the outcome instead.
+func logMarkError(msg, eventID string, err error) {
+	if errors.Is(err, ErrClaimLost) {
+		slog.Warn(msg+": claim lost to another delivery", "eventId", eventID)
+		return
+	}
+	slog.Error(msg, "eventId", eventID, "error", err)
+}
+
+// newClaimToken returns a random token identifying one claim.
+func newClaimToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("claim token: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// claimLease is how long a claim made under ctx lasts: until the invocation deadline plus
+// dedupeLeaseMargin, or dedupeLease without a deadline.
+func claimLease(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return dedupeLease
+	}
+	return time.Until(deadline) + dedupeLeaseMargin
+}
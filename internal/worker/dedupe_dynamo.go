@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	dedupePKPrefix = "EVENT#"
+	dedupeSKValue  = "DEDUPE"
+)
+
+// DynamoDedupeStore implements DedupeStore with DynamoDB. Records (pk EVENT#<eventId>, sk DEDUPE) can
+// share the users table and are removed by its TTL on expiresAt; leaseExpiresAt is in unix seconds too.
+type DynamoDedupeStore struct {
+	client    *dynamodb.Client
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDedupeStore returns a DynamoDedupeStore.
+func NewDynamoDedupeStore(client *dynamodb.Client, tableName string) *DynamoDedupeStore {
+	return &DynamoDedupeStore{client: client, tableName: tableName, now: time.Now}
+}
+
+func dedupeKey(eventID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dedupePKPrefix + eventID},
+		"sk": &types.AttributeValueMemberS{Value: dedupeSKValue},
+	}
+}
+
+func unixAttr(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+// Claim marks eventID in progress for lease with a conditional update that only succeeds if there is
+// no live record, the last attempt failed or its lease expired. On a conflict the old status tells
+// ErrAlreadyProcessed from ErrEventInProgress. The claim token is stored in claimToken.
+func (s *DynamoDedupeStore) Claim(ctx context.Context, eventID, eventType string, lease time.Duration) (string, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: &s.tableName,
+		Key:       dedupeKey(eventID),
+		UpdateExpression: aws.String("SET #status = :inProgress, eventType = :eventType, claimToken = :token, leaseExpiresAt = :lease, " +
+			"expiresAt = :expires, updatedAt = :updatedAt REMOVE lastError ADD attempts :one"),
+		ConditionExpression: aws.String("attribute_not_exists(pk) OR expiresAt <= :now OR #status = :failed " +
+			"OR (#status = :inProgress AND leaseExpiresAt <= :now)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":inProgress": &types.AttributeValueMemberS{Value: StatusInProgress},
+			":failed":     &types.AttributeValueMemberS{Value: StatusFailed},
+			":eventType":  &types.AttributeValueMemberS{Value: eventType},
+			":token":      &types.AttributeValueMemberS{Value: token},
+			":lease":      unixAttr(now.Add(lease)),
+			":expires":    unixAttr(now.Add(dedupeTTL)),
+			":now":        unixAttr(now),
+			":updatedAt":  &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		if status, ok := ccf.Item["status"].(*types.AttributeValueMemberS); ok && status.Value == StatusProcessed {
+			return "", ErrAlreadyProcessed
+		}
+		return "", ErrEventInProgress
+	}
+	if err != nil {
+		return "", fmt.Errorf("claim event: %w", err)
+	}
+	return token, nil
+}
+
+// MarkProcessed records that eventID was processed.
+func (s *DynamoDedupeStore) MarkProcessed(ctx context.Context, eventID, token string) error {
+	return s.finish(ctx, eventID, token, StatusProcessed, "")
+}
+
+// MarkFailed records that processing eventID failed with cause.
+func (s *DynamoDedupeStore) MarkFailed(ctx context.Context, eventID, token string, cause error) error {
+	return s.finish(ctx, eventID, token, StatusFailed, cause.Error())
+}
+
+// finish records the outcome of the claim token. The condition on claimToken keeps a delivery whose
+// lease expired from overwriting the record of the delivery that re-claimed the event.
+func (s *DynamoDedupeStore) finish(ctx context.Context, eventID, token, status, lastError string) error {
+	update := "SET #status = :status, updatedAt = :updatedAt REMOVE claimToken, leaseExpiresAt, lastError"
+	values := map[string]types.AttributeValue{
+		":status":    &types.AttributeValueMemberS{Value: status},
+		":updatedAt": &types.AttributeValueMemberS{Value: s.now().UTC().Format(time.RFC3339)},
+		":token":     &types.AttributeValueMemberS{Value: token},
+	}
+	if lastError != "" {
+		update = "SET #status = :status, updatedAt = :updatedAt, lastError = :lastError REMOVE claimToken, leaseExpiresAt"
+		values[":lastError"] = &types.AttributeValueMemberS{Value: lastError}
+	}
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 &s.tableName,
+		Key:                       dedupeKey(eventID),
+		UpdateExpression:          &update,
+		ConditionExpression:       aws.String("claimToken = :token"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	})
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrClaimLost
+	}
+	if err != nil {
+		return fmt.Errorf("mark event %s: %w", status, err)
+	}
+	return nil
+}
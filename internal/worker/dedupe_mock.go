@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DedupeRecord is the state a MockDedupeStore keeps for an event.
+type DedupeRecord struct {
+	EventType      string
+	Status         string // StatusInProgress, StatusProcessed or StatusFailed
+	Attempts       int
+	LastError      string
+	ClaimToken     string // token of the current claim while in progress
+	LeaseExpiresAt time.Time
+	ExpiresAt      time.Time
+}
+
+// MockDedupeStore is an in-memory DedupeStore for tests. Expired records are ignored like items past
+// their DynamoDB TTL.
+type MockDedupeStore struct {
+	mu      sync.Mutex
+	records map[string]DedupeRecord
+	now     func() time.Time
+
+	ClaimError error // if set, Claim returns this error
+}
+
+// NewMockDedupeStore returns a new MockDedupeStore (empty store).
+func NewMockDedupeStore() *MockDedupeStore {
+	return &MockDedupeStore{records: make(map[string]DedupeRecord), now: time.Now}
+}
+
+// Claim marks eventID in progress for lease unless it was processed or another claim is live.
+func (m *MockDedupeStore) Claim(ctx context.Context, eventID, eventType string, lease time.Duration) (string, error) {
+	if m.ClaimError != nil {
+		return "", m.ClaimError
+	}
+	token, err := newClaimToken()
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	rec, ok := m.records[eventID]
+	if ok && rec.ExpiresAt.After(now) {
+		switch {
+		case rec.Status == StatusProcessed:
+			return "", ErrAlreadyProcessed
+		case rec.Status == StatusInProgress && rec.LeaseExpiresAt.After(now):
+			return "", ErrEventInProgress
+		}
+	} else {
+		rec = DedupeRecord{}
+	}
+	rec.EventType = eventType
+	rec.Status = StatusInProgress
+	rec.Attempts++
+	rec.ClaimToken = token
+	rec.LeaseExpiresAt = now.Add(lease)
+	rec.ExpiresAt = now.Add(dedupeTTL)
+	m.records[eventID] = rec
+	return token, nil
+}
+
+// MarkProcessed records that eventID was processed, unless token is no longer the current claim.
+func (m *MockDedupeStore) MarkProcessed(ctx context.Context, eventID, token string) error {
+	return m.finish(eventID, token, StatusProcessed, "")
+}
+
+// MarkFailed records that processing eventID failed, unless token is no longer the current claim.
+func (m *MockDedupeStore) MarkFailed(ctx context.Context, eventID, token string, cause error) error {
+	return m.finish(eventID, token, StatusFailed, cause.Error())
+}
+
+func (m *MockDedupeStore) finish(eventID, token, status, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[eventID]
+	if !ok || rec.ClaimToken != token {
+		return ErrClaimLost
+	}
+	rec.Status = status
+	rec.LastError = lastError
+	rec.ClaimToken = ""
+	rec.LeaseExpiresAt = time.Time{}
+	m.records[eventID] = rec
+	return nil
+}
+
+// Record returns the state of eventID and whether it exists.
+func (m *MockDedupeStore) Record(eventID string) (DedupeRecord, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec, ok := m.records[eventID]
+	return rec, ok
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+// testLease is the claim lease used by the conformance tests.
+const testLease = time.Minute
+
+// testDedupeStoreConformance runs the DedupeStore contract against the store returned by newStore,
+// which must read the current time from clock.
+func testDedupeStoreConformance(t *testing.T, newStore func(t *testing.T, clock func() time.Time) DedupeStore) {
+	ctx := context.Background()
+	setup := func(t *testing.T) (DedupeStore, *time.Time) {
+		now := time.Now()
+		return newStore(t, func() time.Time { return now }), &now
+	}
+
+	t.Run("claim once, then processed", func(t *testing.T) {
+		s, _ := setup(t)
+		token, err := s.Claim(ctx, "e1", "user.created", testLease)
+		if err != nil || token == "" {
+			t.Fatalf("claim: token %q, %v", token, err)
+		}
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); !errors.Is(err, ErrEventInProgress) {
+			t.Errorf("second claim: expected ErrEventInProgress, got %v", err)
+		}
+		if err := s.MarkProcessed(ctx, "e1", token); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); !errors.Is(err, ErrAlreadyProcessed) {
+			t.Errorf("claim after processing: expected ErrAlreadyProcessed, got %v", err)
+		}
+		if _, err := s.Claim(ctx, "e2", "user.created", testLease); err != nil {
+			t.Errorf("other event: %v", err)
+		}
+	})
+
+	t.Run("failed events can be claimed again", func(t *testing.T) {
+		s, _ := setup(t)
+		token, err := s.Claim(ctx, "e1", "user.created", testLease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MarkFailed(ctx, "e1", token, errors.New("boom")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); err != nil {
+			t.Errorf("claim after failure: %v", err)
+		}
+	})
+
+	t.Run("expired lease and record", func(t *testing.T) {
+		s, now := setup(t)
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(testLease - time.Second)
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); !errors.Is(err, ErrEventInProgress) {
+			t.Errorf("claim within the lease: expected ErrEventInProgress, got %v", err)
+		}
+		*now = now.Add(2 * time.Second)
+		token, err := s.Claim(ctx, "e1", "user.created", testLease)
+		if err != nil {
+			t.Fatalf("claim after the lease expired: %v", err)
+		}
+		if err := s.MarkProcessed(ctx, "e1", token); err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(dedupeTTL + time.Second)
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); err != nil {
+			t.Errorf("claim after the record expired: %v", err)
+		}
+	})
+
+	t.Run("stale claim cannot finish", func(t *testing.T) {
+		s, now := setup(t)
+		stale, err := s.Claim(ctx, "e1", "user.created", testLease)
+		if err != nil {
+			t.Fatal(err)
+		}
+		*now = now.Add(testLease + time.Second)
+		current, err := s.Claim(ctx, "e1", "user.created", testLease)
+		if err != nil {
+			t.Fatalf("reclaim: %v", err)
+		}
+		if current == stale {
+			t.Fatal("reclaim returned the stale token")
+		}
+		// The delivery whose lease expired must not overwrite the outcome of the current one
+		if err := s.MarkProcessed(ctx, "e1", stale); !errors.Is(err, ErrClaimLost) {
+			t.Errorf("stale MarkProcessed: expected ErrClaimLost, got %v", err)
+		}
+		if err := s.MarkFailed(ctx, "e1", stale, errors.New("boom")); !errors.Is(err, ErrClaimLost) {
+			t.Errorf("stale MarkFailed: expected ErrClaimLost, got %v", err)
+		}
+		if _, err := s.Claim(ctx, "e1", "user.created", testLease); !errors.Is(err, ErrEventInProgress) {
+			t.Errorf("after stale finishes: expected ErrEventInProgress, got %v", err)
+		}
+		if err := s.MarkProcessed(ctx, "e1", current); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.MarkProcessed(ctx, "e1", current); !errors.Is(err, ErrClaimLost) {
+			t.Errorf("second MarkProcessed: expected ErrClaimLost, got %v", err)
+		}
+		if err := s.MarkFailed(ctx, "missing", current, errors.New("boom")); !errors.Is(err, ErrClaimLost) {
+			t.Errorf("unclaimed event: expected ErrClaimLost, got %v", err)
+		}
+	})
+}
+
+func TestMockDedupeStore_Conformance(t *testing.T) {
+	testDedupeStoreConformance(t, func(t *testing.T, clock func() time.Time) DedupeStore {
+		s := NewMockDedupeStore()
+		s.now = clock
+		return s
+	})
+}
+
+func userCreatedMessage(t *testing.T, messageID, eventID string) awsevents.SQSMessage {
+	t.Helper()
+	env := events.NewUserCreatedEnvelope("2024-01-01T00:00:00Z", events.UserCreatedV1{UserID: "u1", Email: "a@b.com", Name: "Alice"})
+	env.EventID = eventID
+	raw, err := events.MarshalEnvelope(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return awsevents.SQSMessage{MessageId: messageID, Body: string(raw)}
+}
+
+func TestDispatcher_Dedupe(t *testing.T) {
+	store := NewMockDedupeStore()
+	calls := 0
+	fail := true
+	d := NewDispatcher()
+	d.Use(Dedupe(store))
+	d.Register(events.UserCreatedEventType, func(ctx context.Context, env events.RawEnvelope) error {
+		calls++ // the side effect, e.g. a welcome email
+		if fail {
+			return errors.New("mail server down")
+		}
+		return nil
+	})
+	handle := func(msgs ...awsevents.SQSMessage) int {
+		t.Helper()
+		resp, err := d.HandleSQSEvent(context.Background(), awsevents.SQSEvent{Records: msgs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(resp.BatchItemFailures)
+	}
+
+	// A failed attempt is recorded and retried on redelivery
+	if failures := handle(userCreatedMessage(t, "m1", "evt-1")); failures != 1 || calls != 1 {
+		t.Fatalf("failures %d, calls %d", failures, calls)
+	}
+	if rec, _ := store.Record("evt-1"); rec.Status != StatusFailed || rec.LastError != "mail server down" {
+		t.Errorf("after failure: %+v", rec)
+	}
+	fail = false
+	if failures := handle(userCreatedMessage(t, "m1", "evt-1")); failures != 0 || calls != 2 {
+		t.Fatalf("retry: failures %d, calls %d", failures, calls)
+	}
+	if rec, _ := store.Record("evt-1"); rec.Status != StatusProcessed || rec.Attempts != 2 || rec.EventType != events.UserCreatedEventType {
+		t.Errorf("after retry: %+v", rec)
+	}
+
+	// A redelivered user.created, even in the same batch or as another SQS message, has no side effects
+	if failures := handle(userCreatedMessage(t, "m1", "evt-1"), userCreatedMessage(t, "m2", "evt-1")); failures != 0 || calls != 2 {
+		t.Errorf("duplicates: failures %d, calls %d", failures, calls)
+	}
+
+	// Events without an id are still handled; store errors make the message retry
+	if failures := handle(userCreatedMessage(t, "m3", "")); failures != 0 || calls != 3 {
+		t.Errorf("no event id: failures %d, calls %d", failures, calls)
+	}
+	store.ClaimError = errors.New("throttled")
+	if failures := handle(userCreatedMessage(t, "m4", "evt-2")); failures != 1 || calls != 3 {
+		t.Errorf("claim error: failures %d, calls %d", failures, calls)
+	}
+}
+
+func TestDispatcher_DedupeReclaimsAfterDeadline(t *testing.T) {
+	store := NewMockDedupeStore()
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	calls := 0
+	d := NewDispatcher()
+	d.Use(Dedupe(store))
+	d.Register(events.UserCreatedEventType, func(ctx context.Context, env events.RawEnvelope) error {
+		calls++
+		return nil
+	})
+
+	// An invocation that crashed after claiming the event leaves an in-progress claim behind; the
+	// lease follows its deadline instead of the 15 minute fallback
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(10*time.Second))
+	defer cancel()
+	if _, err := store.Claim(ctx, "evt-1", events.UserCreatedEventType, claimLease(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := store.Record("evt-1")
+	if lease := rec.LeaseExpiresAt.Sub(now); lease > 10*time.Second+dedupeLeaseMargin || lease < dedupeLeaseMargin {
+		t.Errorf("lease %s, want about the deadline plus %s", lease, dedupeLeaseMargin)
+	}
+
+	handle := func() int {
+		t.Helper()
+		resp, err := d.HandleSQSEvent(context.Background(), awsevents.SQSEvent{Records: []awsevents.SQSMessage{userCreatedMessage(t, "m1", "evt-1")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(resp.BatchItemFailures)
+	}
+	// A redelivery while the lease is live is retried later
+	if failures := handle(); failures != 1 || calls != 0 {
+		t.Fatalf("within the lease: failures %d, calls %d", failures, calls)
+	}
+	// Once it runs out, the next redelivery reclaims the event and processes it
+	now = rec.LeaseExpiresAt.Add(time.Second)
+	if failures := handle(); failures != 0 || calls != 1 {
+		t.Fatalf("after the lease: failures %d, calls %d", failures, calls)
+	}
+	if rec, _ := store.Record("evt-1"); rec.Status != StatusProcessed || rec.Attempts != 2 {
+		t.Errorf("after reclaim: %+v", rec)
+	}
+}
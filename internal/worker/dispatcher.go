@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+// ErrNoHandler is returned when a decoded event has no registered handler.
+var ErrNoHandler = errors.New("no handler registered")
+
+// HandlerFunc processes a single decoded event.
+type HandlerFunc func(ctx context.Context, env events.RawEnvelope) error
+
+// Middleware wraps a HandlerFunc, e.g. to deduplicate events.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Dispatcher decodes SQS message bodies and routes them to handlers by event type.
+type Dispatcher struct {
+	handlers    map[string]HandlerFunc // key: event type e.g. "user.created"
+	middlewares []Middleware
+}
+
+// NewDispatcher returns a new Dispatcher.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: make(map[string]HandlerFunc)}
+}
+
+// Use adds middlewares that wrap every registered handler; the first is the outermost.
+func (d *Dispatcher) Use(mw ...Middleware) {
+	d.middlewares = append(d.middlewares, mw...)
+}
+
+// Register associates a handler with an event type.
+func (d *Dispatcher) Register(eventType string, h HandlerFunc) {
+	d.handlers[eventType] = h
+}
+
+// HandleSQSEvent processes every record in the batch. Records that fail to decode or whose
+// handler returns an error are reported in BatchItemFailures so only they are redelivered.
+func (d *Dispatcher) HandleSQSEvent(ctx context.Context, ev awsevents.SQSEvent) (awsevents.SQSEventResponse, error) {
+	var resp awsevents.SQSEventResponse
+	for _, msg := range ev.Records {
+		if err := d.handleMessage(ctx, msg); err != nil {
+			slog.Error("message processing failed", "messageId", msg.MessageId, "error", err)
+			resp.BatchItemFailures = append(resp.BatchItemFailures, awsevents.SQSBatchItemFailure{
+				ItemIdentifier: msg.MessageId,
+			})
+		}
+	}
+	slog.Info("batch processed", "records", len(ev.Records), "failures", len(resp.BatchItemFailures))
+	return resp, nil
+}
+
+func (d *Dispatcher) handleMessage(ctx context.Context, msg awsevents.SQSMessage) error {
+	env, err := decodeMessage(msg)
+	if err != nil {
+		return err
+	}
+	h, ok := d.handlers[env.EventType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, env.EventType)
+	}
+	slog.Info("dispatching event", "messageId", msg.MessageId, "eventType", env.EventType, "version", env.Version, "eventId", env.EventID, "correlationId", env.CorrelationID)
+	for i := len(d.middlewares) - 1; i >= 0; i-- {
+		h = d.middlewares[i](h)
+	}
+	return h(ctx, env)
+}
+
+// decodeMessage decodes the event in msg: a binary-mode CloudEvent when its message attributes carry
+// one, otherwise the body as an envelope or structured-mode CloudEvent.
+func decodeMessage(msg awsevents.SQSMessage) (events.RawEnvelope, error) {
+	attrs := make(map[string]string, len(msg.MessageAttributes))
+	for name, a := range msg.MessageAttributes {
+		if a.StringValue != nil {
+			attrs[name] = *a.StringValue
+		}
+	}
+	if events.IsBinaryCloudEvent(attrs) {
+		return events.DecodeBinaryCloudEvent(attrs, []byte(msg.Body))
+	}
+	return events.DecodeEnvelope([]byte(msg.Body))
+}
@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+	awsevents "github.com/aws/aws-lambda-go/events"
+)
+
+func userCreatedBody(t *testing.T, userID string) string {
+	t.Helper()
+	raw, err := events.MarshalEnvelope(events.NewUserCreatedEnvelope("2024-01-01T00:00:00Z", events.UserCreatedV1{
+		UserID: userID, Email: "a@b.com", Name: "Alice", CreatedBy: "sub-1",
+	}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(raw)
+}
+
+func TestDispatcher_HandleSQSEvent(t *testing.T) {
+	var seen []string
+	d := NewDispatcher()
+	d.Register(events.UserCreatedEventType, func(ctx context.Context, env events.RawEnvelope) error {
+		var p events.UserCreatedV1
+		if err := env.DecodePayload(&p); err != nil {
+			return err
+		}
+		if p.UserID == "fail" {
+			return errors.New("boom")
+		}
+		seen = append(seen, p.UserID)
+		return nil
+	})
+
+	batch := awsevents.SQSEvent{Records: []awsevents.SQSMessage{
+		{MessageId: "m1", Body: userCreatedBody(t, "u1")},
+		{MessageId: "m2", Body: "not json"},
+		{MessageId: "m3", Body: userCreatedBody(t, "fail")},
+		{MessageId: "m4", Body: `{"eventType":"user.created","version":"9","payload":{}}`},
+		{MessageId: "m5", Body: `{"eventType":"user.unknown","version":"1","payload":{}}`},
+		{MessageId: "m6", Body: userCreatedBody(t, "u2")},
+	}}
+	resp, err := d.HandleSQSEvent(context.Background(), batch)
+	if err != nil {
+		t.Fatalf("HandleSQSEvent: %v", err)
+	}
+	if len(seen) != 2 || seen[0] != "u1" || seen[1] != "u2" {
+		t.Errorf("unexpected handled users: %v", seen)
+	}
+	var failed []string
+	for _, f := range resp.BatchItemFailures {
+		failed = append(failed, f.ItemIdentifier)
+	}
+	want := []string{"m2", "m3", "m4", "m5"}
+	if len(failed) != len(want) {
+		t.Fatalf("expected failures %v, got %v", want, failed)
+	}
+	for i := range want {
+		if failed[i] != want[i] {
+			t.Errorf("failure %d: expected %s, got %s", i, want[i], failed[i])
+		}
+	}
+}
+
+func TestDecodeEnvelope_Errors(t *testing.T) {
+	_, err := events.DecodeEnvelope([]byte(`{"eventType":"user.created","version":"2"}`))
+	if !errors.Is(err, events.ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	_, err = events.DecodeEnvelope([]byte(`{"eventType":"other","version":"1"}`))
+	if !errors.Is(err, events.ErrUnknownEventType) {
+		t.Errorf("expected ErrUnknownEventType, got %v", err)
+	}
+}
+
+func TestDispatcher_CloudEvents(t *testing.T) {
+	var seen []string
+	d := NewDispatcher()
+	d.Register(events.UserCreatedEventType, func(ctx context.Context, env events.RawEnvelope) error {
+		var p events.UserCreatedV1
+		if err := env.DecodePayload(&p); err != nil {
+			return err
+		}
+		seen = append(seen, p.UserID+"@"+env.TenantID)
+		return nil
+	})
+	env := events.NewUserCreatedEnvelope("2024-01-01T00:00:00Z", events.UserCreatedV1{UserID: "u1"})
+	env.TenantID = "acme"
+	structured, err := events.MarshalCloudEvent(env, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce, err := events.NewCloudEvent(env, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := make(map[string]awsevents.SQSMessageAttribute)
+	for name, v := range ce.BinaryAttributes() {
+		attrs[name] = awsevents.SQSMessageAttribute{DataType: "String", StringValue: &v}
+	}
+
+	resp, err := d.HandleSQSEvent(context.Background(), awsevents.SQSEvent{Records: []awsevents.SQSMessage{
+		{MessageId: "m1", Body: string(structured)},
+		{MessageId: "m2", Body: string(ce.Data), MessageAttributes: attrs},
+	}})
+	if err != nil || len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("failures %+v, err %v", resp.BatchItemFailures, err)
+	}
+	if len(seen) != 2 || seen[0] != "u1@acme" || seen[1] != "u1@acme" {
+		t.Errorf("unexpected handled events: %v", seen)
+	}
+}
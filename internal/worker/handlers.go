@@ -0,0 +1,49 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/JulianEZT/serverless-user-service/pkg/events"
+)
+
+// HandleUserCreated processes a user.created event. For now it only records the event;
+// background tasks (welcome email, provisioning) hook in here.
+func HandleUserCreated(ctx context.Context, env events.RawEnvelope) error {
+	payload, err := events.Payload[events.UserCreatedV1](env)
+	if err != nil {
+		return err
+	}
+	slog.Info("user created", "tenantId", env.TenantID, "userId", payload.UserID, "createdBy", payload.CreatedBy, "requestId", payload.RequestID)
+	return nil
+}
+
+// HandleUserUpdated processes a user.updated event.
+func HandleUserUpdated(ctx context.Context, env events.RawEnvelope) error {
+	payload, err := events.Payload[events.UserUpdatedV1](env)
+	if err != nil {
+		return err
+	}
+	slog.Info("user updated", "tenantId", env.TenantID, "userId", payload.UserID, "changedFields", payload.ChangedFields, "updatedBy", payload.UpdatedBy, "requestId", payload.RequestID)
+	return nil
+}
+
+// HandleUserDeleted processes a user.deleted event.
+func HandleUserDeleted(ctx context.Context, env events.RawEnvelope) error {
+	payload, err := events.Payload[events.UserDeletedV1](env)
+	if err != nil {
+		return err
+	}
+	slog.Info("user deleted", "tenantId", env.TenantID, "userId", payload.UserID, "deletedBy", payload.DeletedBy, "requestId", payload.RequestID)
+	return nil
+}
+
+// HandleUserRestored processes a user.restored event.
+func HandleUserRestored(ctx context.Context, env events.RawEnvelope) error {
+	payload, err := events.Payload[events.UserRestoredV1](env)
+	if err != nil {
+		return err
+	}
+	slog.Info("user restored", "tenantId", env.TenantID, "userId", payload.UserID, "restoredBy", payload.RestoredBy, "requestId", payload.RequestID)
+	return nil
+}
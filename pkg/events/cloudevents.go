@@ -0,0 +1,195 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CloudEvents 1.0 (https://github.com/cloudevents/spec) encodings of an Envelope. EventType maps to
+// type, OccurredAt to time, Payload to data, EventID to id and Producer to source. Version and TenantID
+// have no standard attribute and travel as the eventversion and tenantid extensions; the version is
+// also part of dataschema. CorrelationID and CausationID are the correlationid and causationid
+// extensions, and TraceParent is the traceparent extension of the distributed tracing spec.
+const (
+	CloudEventsSpecVersion = "1.0"
+	// CloudEventsContentType is the content type of a structured-mode event (the whole event as JSON).
+	CloudEventsContentType = "application/cloudevents+json"
+	// cloudEventsDataContentType is the content type of data, and of the body in binary mode.
+	cloudEventsDataContentType = "application/json"
+	// cloudEventsSchemaPrefix starts dataschema, followed by "<type>/v<version>".
+	cloudEventsSchemaPrefix = "urn:serverless-user-service:schema:"
+	// CloudEventsBinaryPrefix starts the attribute names in binary mode, e.g. "ce-type".
+	CloudEventsBinaryPrefix = "ce-"
+	// CloudEventsBinaryContentType is the binary-mode attribute holding datacontenttype.
+	CloudEventsBinaryContentType = "content-type"
+)
+
+// ErrInvalidCloudEvent is returned when a CloudEvent lacks a required attribute or has another specversion.
+var ErrInvalidCloudEvent = errors.New("invalid CloudEvent")
+
+// CloudEvent is a CloudEvents 1.0 event in structured-mode JSON form.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	EventVersion    string          `json:"eventversion,omitempty"`  // extension: Envelope.Version
+	TenantID        string          `json:"tenantid,omitempty"`      // extension: Envelope.TenantID
+	CorrelationID   string          `json:"correlationid,omitempty"` // extension: Metadata.CorrelationID
+	CausationID     string          `json:"causationid,omitempty"`   // extension: Metadata.CausationID
+	TraceParent     string          `json:"traceparent,omitempty"`   // extension: Metadata.TraceParent
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// NewCloudEvent converts e into a CloudEvent. The id is e.EventID, or a new one if it is empty, and the
+// source is e.Producer, or source if it is empty.
+func NewCloudEvent(e Envelope, source string) (CloudEvent, error) {
+	data, err := json.Marshal(e.Payload)
+	if err != nil {
+		return CloudEvent{}, fmt.Errorf("marshal %s payload: %w", e.EventType, err)
+	}
+	id := e.EventID
+	if id == "" {
+		if id, err = NewEventID(); err != nil {
+			return CloudEvent{}, err
+		}
+	}
+	if e.Producer != "" {
+		source = e.Producer
+	}
+	return CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              id,
+		Source:          source,
+		Type:            e.EventType,
+		DataContentType: cloudEventsDataContentType,
+		DataSchema:      cloudEventsSchemaPrefix + e.EventType + "/v" + e.Version,
+		Time:            e.OccurredAt,
+		EventVersion:    e.Version,
+		TenantID:        e.TenantID,
+		CorrelationID:   e.CorrelationID,
+		CausationID:     e.CausationID,
+		TraceParent:     e.TraceParent,
+		Data:            data,
+	}, nil
+}
+
+// MarshalCloudEvent encodes e as a structured-mode CloudEvent from source.
+func MarshalCloudEvent(e Envelope, source string) ([]byte, error) {
+	ce, err := NewCloudEvent(e, source)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(ce)
+}
+
+// DecodeCloudEvent decodes a structured-mode CloudEvent into a RawEnvelope and, like DecodeEnvelope,
+// checks that its type and version are supported.
+func DecodeCloudEvent(data []byte) (RawEnvelope, error) {
+	var ce CloudEvent
+	if err := json.Unmarshal(data, &ce); err != nil {
+		return RawEnvelope{}, fmt.Errorf("unmarshal CloudEvent: %w", err)
+	}
+	return ce.rawEnvelope()
+}
+
+// BinaryAttributes returns the binary-mode attributes of ce (e.g. as SQS message attributes):
+// every context attribute prefixed with CloudEventsBinaryPrefix, and the data content type as
+// CloudEventsBinaryContentType. In binary mode ce.Data is sent as the body.
+func (ce CloudEvent) BinaryAttributes() map[string]string {
+	attrs := map[string]string{
+		CloudEventsBinaryPrefix + "specversion": ce.SpecVersion,
+		CloudEventsBinaryPrefix + "id":          ce.ID,
+		CloudEventsBinaryPrefix + "source":      ce.Source,
+		CloudEventsBinaryPrefix + "type":        ce.Type,
+	}
+	optional := map[string]string{
+		CloudEventsBinaryContentType:              ce.DataContentType,
+		CloudEventsBinaryPrefix + "dataschema":    ce.DataSchema,
+		CloudEventsBinaryPrefix + "time":          ce.Time,
+		CloudEventsBinaryPrefix + "eventversion":  ce.EventVersion,
+		CloudEventsBinaryPrefix + "tenantid":      ce.TenantID,
+		CloudEventsBinaryPrefix + "correlationid": ce.CorrelationID,
+		CloudEventsBinaryPrefix + "causationid":   ce.CausationID,
+		CloudEventsBinaryPrefix + "traceparent":   ce.TraceParent,
+	}
+	for k, v := range optional {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	return attrs
+}
+
+// IsBinaryCloudEvent reports whether attrs carry a binary-mode CloudEvent.
+func IsBinaryCloudEvent(attrs map[string]string) bool {
+	return attrs[CloudEventsBinaryPrefix+"specversion"] != ""
+}
+
+// DecodeBinaryCloudEvent decodes a binary-mode CloudEvent made of attrs (see BinaryAttributes) and
+// the body data into a RawEnvelope, checking that its type and version are supported.
+func DecodeBinaryCloudEvent(attrs map[string]string, data []byte) (RawEnvelope, error) {
+	attr := func(name string) string { return attrs[CloudEventsBinaryPrefix+name] }
+	ce := CloudEvent{
+		SpecVersion:     attr("specversion"),
+		ID:              attr("id"),
+		Source:          attr("source"),
+		Type:            attr("type"),
+		DataContentType: attrs[CloudEventsBinaryContentType],
+		DataSchema:      attr("dataschema"),
+		Time:            attr("time"),
+		EventVersion:    attr("eventversion"),
+		TenantID:        attr("tenantid"),
+		CorrelationID:   attr("correlationid"),
+		CausationID:     attr("causationid"),
+		TraceParent:     attr("traceparent"),
+		Data:            data,
+	}
+	return ce.rawEnvelope()
+}
+
+func (ce CloudEvent) rawEnvelope() (RawEnvelope, error) {
+	if ce.SpecVersion != CloudEventsSpecVersion {
+		return RawEnvelope{}, fmt.Errorf("%w: specversion %q", ErrInvalidCloudEvent, ce.SpecVersion)
+	}
+	if ce.ID == "" || ce.Source == "" || ce.Type == "" {
+		return RawEnvelope{}, fmt.Errorf("%w: id, source and type are required", ErrInvalidCloudEvent)
+	}
+	if ct := ce.DataContentType; ct != "" && !strings.HasPrefix(ct, cloudEventsDataContentType) {
+		return RawEnvelope{}, fmt.Errorf("%w: unsupported datacontenttype %q", ErrInvalidCloudEvent, ct)
+	}
+	env := RawEnvelope{
+		EventType:  ce.Type,
+		Version:    ce.EventVersion,
+		OccurredAt: ce.Time,
+		TenantID:   ce.TenantID,
+		Payload:    ce.Data,
+		Metadata: Metadata{
+			EventID:       ce.ID,
+			CorrelationID: ce.CorrelationID,
+			CausationID:   ce.CausationID,
+			Producer:      ce.Source,
+			TraceParent:   ce.TraceParent,
+		},
+	}
+	return env, checkSupported(env)
+}
+
+// NewEventID returns a random (version 4) UUID for Metadata.EventID.
+func NewEventID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("generate event id: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
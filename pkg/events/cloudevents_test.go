@@ -0,0 +1,163 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+var testEnvelope = Envelope{
+	EventType:  UserDeletedEventType,
+	Version:    UserDeletedV1Version,
+	OccurredAt: "2024-01-02T00:00:00Z",
+	TenantID:   "acme",
+	Payload:    UserDeletedV1{UserID: "u1", DeletedAt: "2024-01-02T00:00:00Z", DeletedBy: "admin"},
+}
+
+func checkDecoded(t *testing.T, env RawEnvelope) {
+	t.Helper()
+	var p UserDeletedV1
+	if err := env.DecodePayload(&p); err != nil {
+		t.Fatal(err)
+	}
+	if env.EventType != testEnvelope.EventType || env.Version != "1" || env.OccurredAt != testEnvelope.OccurredAt || env.TenantID != "acme" || p.UserID != "u1" || p.DeletedBy != "admin" {
+		t.Errorf("decoded %+v with payload %+v", env, p)
+	}
+}
+
+func TestCloudEvent_Structured(t *testing.T) {
+	raw, err := MarshalCloudEvent(testEnvelope, "test-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(raw, &attrs); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"specversion":     "1.0",
+		"source":          "test-source",
+		"type":            "user.deleted",
+		"datacontenttype": "application/json",
+		"dataschema":      "urn:serverless-user-service:schema:user.deleted/v1",
+		"time":            "2024-01-02T00:00:00Z",
+		"eventversion":    "1",
+		"tenantid":        "acme",
+	}
+	for k, v := range want {
+		if attrs[k] != v {
+			t.Errorf("%s = %v, want %q", k, attrs[k], v)
+		}
+	}
+	if id, _ := attrs["id"].(string); !uuidRegex.MatchString(id) {
+		t.Errorf("id = %v, want a UUID", attrs["id"])
+	}
+
+	env, err := DecodeCloudEvent(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, env)
+	// DecodeEnvelope recognizes structured CloudEvents
+	if env, err = DecodeEnvelope(raw); err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, env)
+
+	other, _ := NewCloudEvent(testEnvelope, "test-source")
+	if other.ID == attrs["id"] {
+		t.Error("ids must be unique per event")
+	}
+}
+
+func TestCloudEvent_Binary(t *testing.T) {
+	ce, err := NewCloudEvent(testEnvelope, "test-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := ce.BinaryAttributes()
+	if attrs["ce-type"] != "user.deleted" || attrs["ce-id"] != ce.ID || attrs["content-type"] != "application/json" || attrs["ce-tenantid"] != "acme" {
+		t.Errorf("unexpected attributes %v", attrs)
+	}
+	if !IsBinaryCloudEvent(attrs) {
+		t.Error("IsBinaryCloudEvent = false")
+	}
+	env, err := DecodeBinaryCloudEvent(attrs, ce.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, env)
+
+	ce.TenantID = ""
+	if _, ok := ce.BinaryAttributes()["ce-tenantid"]; ok {
+		t.Error("empty extensions must be omitted")
+	}
+}
+
+func TestCloudEvent_Metadata(t *testing.T) {
+	e := testEnvelope
+	e.Metadata = Metadata{
+		EventID:       "7f0c2a1e-0b1d-4c39-9d61-0d7c1c1f6a10",
+		CorrelationID: "corr-1",
+		CausationID:   "req-1",
+		Producer:      "user-api",
+		TraceParent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	ce, err := NewCloudEvent(e, "test-source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ce.ID != e.EventID || ce.Source != "user-api" || ce.CorrelationID != "corr-1" || ce.CausationID != "req-1" || ce.TraceParent != e.TraceParent {
+		t.Errorf("unexpected CloudEvent %+v", ce)
+	}
+
+	raw, _ := json.Marshal(ce)
+	structured, err := DecodeCloudEvent(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := DecodeBinaryCloudEvent(ce.BinaryAttributes(), ce.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range []RawEnvelope{structured, binary} {
+		if env.Metadata != e.Metadata {
+			t.Errorf("metadata %+v, want %+v", env.Metadata, e.Metadata)
+		}
+	}
+}
+
+func TestNewEventID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewEventID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !uuidRegex.MatchString(id) || seen[id] {
+			t.Fatalf("id %q is not a new version 4 UUID", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestDecodeCloudEvent_Errors(t *testing.T) {
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"specversion":"0.3","id":"1","source":"s","type":"user.deleted","eventversion":"1"}`, ErrInvalidCloudEvent},
+		{`{"specversion":"1.0","source":"s","type":"user.deleted","eventversion":"1"}`, ErrInvalidCloudEvent},
+		{`{"specversion":"1.0","id":"1","source":"s","type":"user.deleted","eventversion":"1","datacontenttype":"text/xml"}`, ErrInvalidCloudEvent},
+		{`{"specversion":"1.0","id":"1","source":"s","type":"user.deleted","eventversion":"9"}`, ErrUnsupportedVersion},
+		{`{"specversion":"1.0","id":"1","source":"s","type":"order.placed","eventversion":"1"}`, ErrUnknownEventType},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeEnvelope([]byte(tt.body)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.body, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownEventType is returned when an envelope carries an event type this package does not define.
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// ErrUnsupportedVersion is returned when an envelope carries a known event type with an unsupported version.
+var ErrUnsupportedVersion = errors.New("unsupported event version")
+
+// RawEnvelope is a decoded envelope whose payload has not been unmarshalled yet.
+// Consumers decode the payload into its concrete type with Payload or a Registry.
+type RawEnvelope struct {
+	EventType  string          `json:"eventType"`
+	Version    string          `json:"version"`
+	OccurredAt string          `json:"occurredAt"`
+	TenantID   string          `json:"tenantId,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+	Metadata
+}
+
+// DecodeEnvelope unmarshals an envelope and checks that its EventType and Version are supported.
+// A structured-mode CloudEvent (recognized by its specversion) is decoded with DecodeCloudEvent, so
+// consumers keep working whichever format the publisher is configured with.
+func DecodeEnvelope(data []byte) (RawEnvelope, error) {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.SpecVersion != "" {
+		return DecodeCloudEvent(data)
+	}
+	var env RawEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return RawEnvelope{}, fmt.Errorf("unmarshal envelope: %w", err)
+	}
+	return env, checkSupported(env)
+}
+
+// checkSupported returns an *UnsupportedEventError unless DefaultRegistry can decode env.
+func checkSupported(env RawEnvelope) error {
+	return DefaultRegistry.Supports(env.EventType, env.Version)
+}
+
+// DecodePayload unmarshals the envelope payload into v.
+func (e RawEnvelope) DecodePayload(v interface{}) error {
+	if len(e.Payload) == 0 {
+		return fmt.Errorf("empty payload for %s", e.EventType)
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("unmarshal %s payload: %w", e.EventType, err)
+	}
+	return nil
+}
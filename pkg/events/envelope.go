@@ -4,8 +4,20 @@ package events
 type Envelope struct {
 	EventType  string      `json:"eventType"`
 	Version    string      `json:"version"`
-	OccurredAt string      `json:"occurredAt"` // ISO8601
+	OccurredAt string      `json:"occurredAt"`         // ISO8601
+	TenantID   string      `json:"tenantId,omitempty"` // tenant the event belongs to; empty in single-tenant deployments
 	Payload    interface{} `json:"payload"`
+	Metadata
+}
+
+// Metadata identifies an event and ties it to the request and trace that produced it. The fields are
+// optional on the wire because events published before they existed do not carry them.
+type Metadata struct {
+	EventID       string `json:"eventId,omitempty"`       // unique per event (a UUID); consumers dedupe on it
+	CorrelationID string `json:"correlationId,omitempty"` // shared by every request and event of one flow
+	CausationID   string `json:"causationId,omitempty"`   // id of the request or event that caused this one
+	Producer      string `json:"producer,omitempty"`      // service that published the event
+	TraceParent   string `json:"traceparent,omitempty"`   // W3C trace context of the producing request
 }
 
 // UserCreatedEventType is the event type string for user-created events.
@@ -13,3 +25,21 @@ const UserCreatedEventType = "user.created"
 
 // UserCreatedV1Version is the schema version for UserCreatedV1.
 const UserCreatedV1Version = "1"
+
+// UserUpdatedEventType is the event type string for user-updated events.
+const UserUpdatedEventType = "user.updated"
+
+// UserUpdatedV1Version is the schema version for UserUpdatedV1.
+const UserUpdatedV1Version = "1"
+
+// UserDeletedEventType is the event type string for user-deleted events.
+const UserDeletedEventType = "user.deleted"
+
+// UserDeletedV1Version is the schema version for UserDeletedV1.
+const UserDeletedV1Version = "1"
+
+// UserRestoredEventType is the event type string for user-restored events.
+const UserRestoredEventType = "user.restored"
+
+// UserRestoredV1Version is the schema version for UserRestoredV1.
+const UserRestoredV1Version = "1"
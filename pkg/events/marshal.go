@@ -16,3 +16,33 @@ func NewUserCreatedEnvelope(occurredAt string, payload UserCreatedV1) Envelope {
 		Payload:    payload,
 	}
 }
+
+// NewUserUpdatedEnvelope builds an envelope for UserUpdatedV1.
+func NewUserUpdatedEnvelope(occurredAt string, payload UserUpdatedV1) Envelope {
+	return Envelope{
+		EventType:  UserUpdatedEventType,
+		Version:    UserUpdatedV1Version,
+		OccurredAt: occurredAt,
+		Payload:    payload,
+	}
+}
+
+// NewUserDeletedEnvelope builds an envelope for UserDeletedV1.
+func NewUserDeletedEnvelope(occurredAt string, payload UserDeletedV1) Envelope {
+	return Envelope{
+		EventType:  UserDeletedEventType,
+		Version:    UserDeletedV1Version,
+		OccurredAt: occurredAt,
+		Payload:    payload,
+	}
+}
+
+// NewUserRestoredEnvelope builds an envelope for UserRestoredV1.
+func NewUserRestoredEnvelope(occurredAt string, payload UserRestoredV1) Envelope {
+	return Envelope{
+		EventType:  UserRestoredEventType,
+		Version:    UserRestoredV1Version,
+		OccurredAt: occurredAt,
+		Payload:    payload,
+	}
+}
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnsupportedEventError is returned when a Registry has no decoder for an event's type and version.
+// Err is ErrUnknownEventType or ErrUnsupportedVersion, so errors.Is works with either sentinel.
+type UnsupportedEventError struct {
+	EventType string
+	Version   string
+	Err       error
+}
+
+func (e *UnsupportedEventError) Error() string {
+	if e.Err == ErrUnknownEventType {
+		return fmt.Sprintf("%v: %q", e.Err, e.EventType)
+	}
+	return fmt.Sprintf("%v: %s v%s", e.Err, e.EventType, e.Version)
+}
+
+func (e *UnsupportedEventError) Unwrap() error {
+	return e.Err
+}
+
+// Event is a decoded event whose Payload is the concrete struct of the latest version of its type
+// (e.g. UserCreatedV1), after any upcasting.
+type Event struct {
+	EventType  string
+	Version    string // version of Payload; may be newer than the version on the wire
+	OccurredAt string
+	TenantID   string
+	Payload    interface{}
+	Metadata
+}
+
+type registryKey struct {
+	eventType string
+	version   string
+}
+
+type upcaster struct {
+	to      string
+	convert func(interface{}) (interface{}, error)
+}
+
+// Registry decodes payloads into concrete structs by (EventType, Version) and upcasts older versions
+// step by step (v1 -> v2 -> ...) to the latest one, so consumers only handle the latest struct.
+// Registration is not safe for concurrent use; register everything before decoding.
+type Registry struct {
+	decoders  map[registryKey]func(json.RawMessage) (interface{}, error)
+	types     map[registryKey]reflect.Type
+	upcasters map[registryKey]upcaster // keyed by the version upcast from
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		decoders:  make(map[registryKey]func(json.RawMessage) (interface{}, error)),
+		types:     make(map[registryKey]reflect.Type),
+		upcasters: make(map[registryKey]upcaster),
+	}
+}
+
+// Register makes r decode payloads of eventType at version into T.
+func Register[T any](r *Registry, eventType, version string) {
+	r.types[registryKey{eventType, version}] = reflect.TypeOf((*T)(nil)).Elem()
+	r.decoders[registryKey{eventType, version}] = func(raw json.RawMessage) (interface{}, error) {
+		var v T
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, fmt.Errorf("unmarshal %s v%s payload: %w", eventType, version, err)
+		}
+		return v, nil
+	}
+}
+
+// RegisterUpcaster makes r convert eventType payloads from version from (decoded as From) to version
+// to with fn. Both versions must be registered with Register.
+func RegisterUpcaster[From, To any](r *Registry, eventType, from, to string, fn func(From) (To, error)) {
+	r.upcasters[registryKey{eventType, from}] = upcaster{to: to, convert: func(v interface{}) (interface{}, error) {
+		in, ok := v.(From)
+		if !ok {
+			return nil, fmt.Errorf("upcast %s v%s: payload is %T", eventType, from, v)
+		}
+		return fn(in)
+	}}
+}
+
+// Supports returns nil if r can decode eventType at version, or an *UnsupportedEventError.
+func (r *Registry) Supports(eventType, version string) error {
+	if _, ok := r.decoders[registryKey{eventType, version}]; ok {
+		return nil
+	}
+	for k := range r.decoders {
+		if k.eventType == eventType {
+			return &UnsupportedEventError{EventType: eventType, Version: version, Err: ErrUnsupportedVersion}
+		}
+	}
+	return &UnsupportedEventError{EventType: eventType, Version: version, Err: ErrUnknownEventType}
+}
+
+// Decode decodes the payload of env and upcasts it to the latest registered version.
+func (r *Registry) Decode(env RawEnvelope) (Event, error) {
+	if err := r.Supports(env.EventType, env.Version); err != nil {
+		return Event{}, err
+	}
+	if len(env.Payload) == 0 {
+		return Event{}, fmt.Errorf("empty payload for %s", env.EventType)
+	}
+	payload, err := r.decoders[registryKey{env.EventType, env.Version}](env.Payload)
+	if err != nil {
+		return Event{}, err
+	}
+	version := env.Version
+	for seen := map[string]bool{version: true}; ; {
+		up, ok := r.upcasters[registryKey{env.EventType, version}]
+		if !ok {
+			break
+		}
+		if seen[up.to] {
+			return Event{}, fmt.Errorf("upcast %s: cycle at v%s", env.EventType, up.to)
+		}
+		seen[up.to] = true
+		if payload, err = up.convert(payload); err != nil {
+			return Event{}, fmt.Errorf("upcast %s v%s to v%s: %w", env.EventType, version, up.to, err)
+		}
+		version = up.to
+	}
+	return Event{EventType: env.EventType, Version: version, OccurredAt: env.OccurredAt, TenantID: env.TenantID, Payload: payload, Metadata: env.Metadata}, nil
+}
+
+// Registration is an event type and version registered with a Registry and its payload type.
+type Registration struct {
+	EventType   string
+	Version     string
+	PayloadType reflect.Type
+}
+
+// Registrations returns everything registered with r, sorted by event type and version.
+func (r *Registry) Registrations() []Registration {
+	out := make([]Registration, 0, len(r.types))
+	for k, t := range r.types {
+		out = append(out, Registration{EventType: k.eventType, Version: k.version, PayloadType: t})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].EventType != out[j].EventType {
+			return out[i].EventType < out[j].EventType
+		}
+		return versionLess(out[i].Version, out[j].Version)
+	})
+	return out
+}
+
+// versionLess orders versions numerically ("2" before "10"), ignoring a leading "v". Versions that
+// are not numbers sort after numeric ones, by their text.
+func versionLess(a, b string) bool {
+	na, errA := strconv.Atoi(strings.TrimPrefix(a, "v"))
+	nb, errB := strconv.Atoi(strings.TrimPrefix(b, "v"))
+	switch {
+	case errA == nil && errB == nil && na != nb:
+		return na < nb
+	case errA == nil && errB != nil:
+		return true
+	case errA != nil && errB == nil:
+		return false
+	}
+	return a < b
+}
+
+// Registered returns every registered (event type, version) pair as "type/vN", sorted.
+func (r *Registry) Registered() []string {
+	regs := r.Registrations()
+	out := make([]string, len(regs))
+	for i, reg := range regs {
+		out[i] = reg.EventType + "/v" + reg.Version
+	}
+	return out
+}
+
+// DecodeAs decodes env with r and returns its payload as T, the latest version of the event's type.
+func DecodeAs[T any](r *Registry, env RawEnvelope) (T, error) {
+	var zero T
+	ev, err := r.Decode(env)
+	if err != nil {
+		return zero, err
+	}
+	v, ok := ev.Payload.(T)
+	if !ok {
+		return zero, fmt.Errorf("%s v%s decodes to %T, not %T", ev.EventType, ev.Version, ev.Payload, zero)
+	}
+	return v, nil
+}
+
+// DefaultRegistry holds every event defined in this package. DecodeEnvelope checks envelopes against
+// it, and Payload decodes with it.
+var DefaultRegistry = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	Register[UserCreatedV1](r, UserCreatedEventType, UserCreatedV1Version)
+	Register[UserUpdatedV1](r, UserUpdatedEventType, UserUpdatedV1Version)
+	Register[UserDeletedV1](r, UserDeletedEventType, UserDeletedV1Version)
+	Register[UserRestoredV1](r, UserRestoredEventType, UserRestoredV1Version)
+	return r
+}
+
+// Payload decodes the payload of env with DefaultRegistry into T, upcasting older versions.
+// T must be the latest version of the event's type, e.g. events.Payload[events.UserCreatedV1](env).
+func Payload[T any](env RawEnvelope) (T, error) {
+	return DecodeAs[T](DefaultRegistry, env)
+}
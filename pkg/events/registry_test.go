@@ -0,0 +1,161 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// registeredSamples has one envelope per (type, version) in DefaultRegistry.
+var registeredSamples = []Envelope{
+	NewUserCreatedEnvelope("2024-01-01T00:00:00Z", UserCreatedV1{UserID: "u1", Email: "a@example.com", Name: "A", CreatedAt: "2024-01-01T00:00:00Z", CreatedBy: "admin", RequestID: "r1"}),
+	NewUserUpdatedEnvelope("2024-01-02T00:00:00Z", UserUpdatedV1{UserID: "u1", Email: "a@example.com", Name: "B", ChangedFields: []string{"name"}, UpdatedAt: "2024-01-02T00:00:00Z", UpdatedBy: "admin"}),
+	NewUserDeletedEnvelope("2024-01-03T00:00:00Z", UserDeletedV1{UserID: "u1", DeletedAt: "2024-01-03T00:00:00Z", DeletedBy: "admin"}),
+	NewUserRestoredEnvelope("2024-01-04T00:00:00Z", UserRestoredV1{UserID: "u1", RestoredAt: "2024-01-04T00:00:00Z", RestoredBy: "admin"}),
+}
+
+func TestDefaultRegistry_RoundTrip(t *testing.T) {
+	var covered []string
+	for _, e := range registeredSamples {
+		e.TenantID = "acme"
+		covered = append(covered, e.EventType+"/v"+e.Version)
+		t.Run(e.EventType, func(t *testing.T) {
+			raw, err := MarshalEnvelope(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env, err := DecodeEnvelope(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ev, err := DefaultRegistry.Decode(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ev.EventType != e.EventType || ev.Version != e.Version || ev.OccurredAt != e.OccurredAt || ev.TenantID != "acme" {
+				t.Errorf("decoded %+v from %s", ev, raw)
+			}
+			if !reflect.DeepEqual(ev.Payload, e.Payload) {
+				t.Errorf("payload %#v, want %#v", ev.Payload, e.Payload)
+			}
+		})
+	}
+	sort.Strings(covered)
+	if got := DefaultRegistry.Registered(); !reflect.DeepEqual(got, covered) {
+		t.Errorf("samples cover %v but the registry has %v; add a sample for every registered event", covered, got)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	raw, _ := MarshalEnvelope(registeredSamples[0])
+	env, err := DecodeEnvelope(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Payload[UserCreatedV1](env)
+	if err != nil || p.Email != "a@example.com" {
+		t.Errorf("Payload: %+v, %v", p, err)
+	}
+	if _, err := Payload[UserDeletedV1](env); err == nil {
+		t.Error("expected an error decoding user.created as UserDeletedV1")
+	}
+}
+
+// userCreatedV2 is a made-up next version of user.created that splits Name.
+type userCreatedV2 struct {
+	UserID     string `json:"userId"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+// userCreatedV3 adds a display name derived from v2.
+type userCreatedV3 struct {
+	userCreatedV2
+	DisplayName string `json:"displayName"`
+}
+
+func TestRegistry_Upcast(t *testing.T) {
+	r := NewRegistry()
+	Register[UserCreatedV1](r, UserCreatedEventType, "1")
+	Register[userCreatedV2](r, UserCreatedEventType, "2")
+	Register[userCreatedV3](r, UserCreatedEventType, "3")
+	RegisterUpcaster(r, UserCreatedEventType, "1", "2", func(v UserCreatedV1) (userCreatedV2, error) {
+		given, family, _ := strings.Cut(v.Name, " ")
+		return userCreatedV2{UserID: v.UserID, GivenName: given, FamilyName: family}, nil
+	})
+	RegisterUpcaster(r, UserCreatedEventType, "2", "3", func(v userCreatedV2) (userCreatedV3, error) {
+		return userCreatedV3{userCreatedV2: v, DisplayName: v.GivenName + " " + v.FamilyName}, nil
+	})
+
+	want := userCreatedV3{userCreatedV2{UserID: "u1", GivenName: "Jane", FamilyName: "Doe"}, "Jane Doe"}
+	for _, tt := range []struct {
+		version, payload string
+	}{
+		{"1", `{"userId":"u1","name":"Jane Doe"}`},
+		{"2", `{"userId":"u1","givenName":"Jane","familyName":"Doe"}`},
+		{"3", `{"userId":"u1","givenName":"Jane","familyName":"Doe","displayName":"Jane Doe"}`},
+	} {
+		env := RawEnvelope{EventType: UserCreatedEventType, Version: tt.version, Payload: []byte(tt.payload)}
+		ev, err := r.Decode(env)
+		if err != nil {
+			t.Fatalf("v%s: %v", tt.version, err)
+		}
+		if ev.Version != "3" || ev.Payload != want {
+			t.Errorf("v%s decoded to v%s %+v, want v3 %+v", tt.version, ev.Version, ev.Payload, want)
+		}
+		if p, err := DecodeAs[userCreatedV3](r, env); err != nil || p != want {
+			t.Errorf("DecodeAs v%s: %+v, %v", tt.version, p, err)
+		}
+	}
+
+	// A failing upcaster fails the decode
+	RegisterUpcaster(r, UserCreatedEventType, "2", "3", func(v userCreatedV2) (userCreatedV3, error) {
+		return userCreatedV3{}, errors.New("no family name")
+	})
+	if _, err := r.Decode(RawEnvelope{EventType: UserCreatedEventType, Version: "1", Payload: []byte(`{"name":"Jane"}`)}); err == nil || !strings.Contains(err.Error(), "no family name") {
+		t.Errorf("expected the upcaster error, got %v", err)
+	}
+}
+
+func TestRegistry_Unsupported(t *testing.T) {
+	tests := []struct {
+		env  RawEnvelope
+		want error
+	}{
+		{RawEnvelope{EventType: "order.placed", Version: "1", Payload: []byte(`{}`)}, ErrUnknownEventType},
+		{RawEnvelope{EventType: UserDeletedEventType, Version: "9", Payload: []byte(`{}`)}, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		_, err := DefaultRegistry.Decode(tt.env)
+		var ue *UnsupportedEventError
+		if !errors.As(err, &ue) || !errors.Is(err, tt.want) {
+			t.Errorf("%s v%s: expected *UnsupportedEventError wrapping %v, got %v", tt.env.EventType, tt.env.Version, tt.want, err)
+			continue
+		}
+		if ue.EventType != tt.env.EventType || ue.Version != tt.env.Version {
+			t.Errorf("error %+v does not name %s v%s", ue, tt.env.EventType, tt.env.Version)
+		}
+	}
+
+	// DecodeEnvelope reports the same typed error
+	_, err := DecodeEnvelope([]byte(`{"eventType":"user.deleted","version":"9","payload":{}}`))
+	var ue *UnsupportedEventError
+	if !errors.As(err, &ue) || ue.Err != ErrUnsupportedVersion {
+		t.Errorf("DecodeEnvelope: expected *UnsupportedEventError, got %v", err)
+	}
+}
+
+func TestRegistry_RegistrationsOrderVersionsNumerically(t *testing.T) {
+	r := NewRegistry()
+	Register[UserCreatedV1](r, UserCreatedEventType, "10")
+	Register[UserCreatedV1](r, UserCreatedEventType, "2")
+	Register[UserCreatedV1](r, UserCreatedEventType, "1")
+	Register[UserDeletedV1](r, UserDeletedEventType, "1")
+
+	want := []string{"user.created/v1", "user.created/v2", "user.created/v10", "user.deleted/v1"}
+	if got := r.Registered(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Registered() = %v, want %v", got, want)
+	}
+}
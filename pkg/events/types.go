@@ -3,10 +3,38 @@ package events
 // UserCreatedV1 is the versioned payload for a user-created event.
 // Used when publishing to SQS for async processing (Lambda B).
 type UserCreatedV1 struct {
-	UserID      string `json:"userId"`
-	Email       string `json:"email"`
-	Name        string `json:"name"`
-	CreatedAt   string `json:"createdAt"`   // ISO8601
-	CreatedBy   string `json:"createdBy"`   // JWT sub (requester)
-	RequestID   string `json:"requestId,omitempty"`
+	UserID    string `json:"userId"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"createdAt"` // ISO8601
+	CreatedBy string `json:"createdBy"` // JWT sub (requester)
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// UserUpdatedV1 is the versioned payload for a user-updated event.
+// Email and Name carry the values after the update; ChangedFields lists which of them changed.
+type UserUpdatedV1 struct {
+	UserID        string   `json:"userId"`
+	Email         string   `json:"email"`
+	Name          string   `json:"name"`
+	ChangedFields []string `json:"changedFields"` // e.g. ["email", "name"]
+	UpdatedAt     string   `json:"updatedAt"`     // ISO8601
+	UpdatedBy     string   `json:"updatedBy"`     // JWT sub (requester)
+	RequestID     string   `json:"requestId,omitempty"`
+}
+
+// UserDeletedV1 is the versioned payload for a user-deleted (soft delete) event.
+type UserDeletedV1 struct {
+	UserID    string `json:"userId"`
+	DeletedAt string `json:"deletedAt"` // ISO8601
+	DeletedBy string `json:"deletedBy"` // JWT sub (requester)
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// UserRestoredV1 is the versioned payload for a user-restored event (undo of a soft delete).
+type UserRestoredV1 struct {
+	UserID     string `json:"userId"`
+	RestoredAt string `json:"restoredAt"` // ISO8601
+	RestoredBy string `json:"restoredBy"` // JWT sub (requester)
+	RequestID  string `json:"requestId,omitempty"`
 }